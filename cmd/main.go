@@ -1,16 +1,27 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
 
+	"github.com/Manuelmastro/mobilehub-product/v3/pkg/auth"
 	"github.com/Manuelmastro/mobilehub-product/v3/pkg/config"
 	"github.com/Manuelmastro/mobilehub-product/v3/pkg/db"
+	"github.com/Manuelmastro/mobilehub-product/v3/pkg/health"
 	pb "github.com/Manuelmastro/mobilehub-product/v3/pkg/pb"
+	"github.com/Manuelmastro/mobilehub-product/v3/pkg/repository"
 	services "github.com/Manuelmastro/mobilehub-product/v3/pkg/services"
+	"github.com/Manuelmastro/mobilehub-product/v3/pkg/worker"
 
 	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 )
 
 func main() {
@@ -20,7 +31,14 @@ func main() {
 		log.Fatalln("Failed at config", err)
 	}
 
-	h := db.Init(c.DBUrl)
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := migrate(c, os.Args[2:]); err != nil {
+			log.Fatalln("Failed to migrate:", err)
+		}
+		return
+	}
+
+	h := db.Init(c.DBUrl, c.MigrateOnStart)
 
 	lis, err := net.Listen("tcp", c.Port)
 
@@ -31,14 +49,152 @@ func main() {
 	fmt.Println("Product Svc on", c.Port)
 
 	s := services.ProductServiceServer{
-		H: h,
+		Products:          repository.NewGormProducts(h.DB),
+		Variants:          repository.NewGormVariants(h.DB),
+		Categories:        repository.NewGormCategories(h.DB),
+		Offers:            repository.NewGormOffers(h.DB),
+		Inventory:         repository.NewGormInventory(h.DB),
+		ReservationTTL:    c.ReservationTTL,
+		IdempotencyKeyTTL: c.IdempotencyKeyTTL,
+		Currency:          c.Currency,
+
+		DeletedProductRetention: time.Duration(c.DeletedProductRetentionDays) * 24 * time.Hour,
+		PopularityWindow:        c.PopularityWindow,
+	}
+
+	// SIGTERM from the orchestrator, or Ctrl-C, starts the shutdown.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	workers := worker.NewGroup(ctx)
+
+	workers.Every("reservation sweeper", c.ReservationSweepInterval, s.ReleaseExpiredReservations)
+	workers.Every("idempotency key cleanup", c.IdempotencyKeyCleanupInterval, s.DeleteExpiredIdempotencyKeys)
+	if s.DeletedProductRetention > 0 {
+		workers.Every("deleted product purge", c.DeletedProductPurgeInterval, s.PurgeDeletedProducts)
+	}
+	workers.Every("popularity refresh", c.PopularityRefreshInterval, s.RefreshPopularity)
+
+	sqlDB, err := h.DB.DB()
+
+	if err != nil {
+		log.Fatalln("Failed at database:", err)
 	}
 
-	grpcServer := grpc.NewServer()
+	monitor := health.NewMonitor(sqlDB, c.HealthFailureThreshold, pb.ProductService_ServiceDesc.ServiceName)
+
+	if err := monitor.Check(ctx); err != nil {
+		log.Println("health check:", err)
+	}
+
+	workers.Every("health check", c.HealthCheckInterval, monitor.Check)
+
+	keys, err := auth.ParseKeySet(c.JWTKeys)
+
+	if err != nil {
+		log.Fatalln("Failed at JWT keys:", err)
+	}
+
+	interceptor := auth.NewInterceptor(auth.NewVerifier(keys, c.JWTIssuer), auth.ProductServicePolicy)
+
+	unary := &unaryTracker{}
+
+	grpcServer := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(unary.Unary(), interceptor.Unary()),
+		grpc.ChainStreamInterceptor(interceptor.Stream()),
+		grpc.WaitForHandlers(true),
+	)
 
 	pb.RegisterProductServiceServer(grpcServer, &s)
+	healthpb.RegisterHealthServer(grpcServer, monitor.Server())
+
+	served := make(chan error, 1)
+
+	go func() { served <- grpcServer.Serve(lis) }()
 
-	if err := grpcServer.Serve(lis); err != nil {
+	select {
+	case err := <-served:
+		monitor.Shutdown()
 		log.Fatalln("Failed to serve:", err)
+	case <-ctx.Done():
+	}
+
+	// A second signal kills the process straight away.
+	stop()
+
+	fmt.Println("Product Svc shutting down")
+
+	monitor.Shutdown()
+	drain(grpcServer, unary, c.ShutdownTimeout)
+	workers.Wait()
+
+	if err := sqlDB.Close(); err != nil {
+		log.Println("Failed to close database:", err)
+	}
+}
+
+// drain stops the server taking new RPCs and waits up to timeout for the
+// running unary ones. Health watches never finish on their own, so the server
+// stops as soon as the last unary RPC is done, or at the timeout, which
+// cancels whatever still runs. Stop waits for the handlers to return, their
+// transactions run on the cancelled context and roll back, so a ReduceStock
+// cut off takes no stock and none is in flight when the database closes.
+func drain(grpcServer *grpc.Server, unary *unaryTracker, timeout time.Duration) {
+	stopped := make(chan struct{})
+
+	go func() {
+		grpcServer.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		return
+	case <-unary.Idle():
+	case <-time.After(timeout):
+		log.Println("RPCs still running after", timeout, "cancelling them")
+	}
+	grpcServer.Stop()
+	<-stopped
+}
+
+// unaryTracker counts the unary RPCs being served.
+type unaryTracker struct {
+	mu      sync.Mutex
+	running int
+	idle    chan struct{} // closed when running drops to zero
+}
+
+// Unary is the interceptor doing the counting, it goes first in the chain.
+func (t *unaryTracker) Unary() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		t.add(1)
+		defer t.add(-1)
+		return handler(ctx, req)
+	}
+}
+
+// Idle returns a channel that is closed once no unary RPC is running.
+func (t *unaryTracker) Idle() <-chan struct{} {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.running == 0 {
+		idle := make(chan struct{})
+		close(idle)
+		return idle
+	}
+	if t.idle == nil {
+		t.idle = make(chan struct{})
+	}
+	return t.idle
+}
+
+func (t *unaryTracker) add(delta int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.running += delta
+	if t.running == 0 && t.idle != nil {
+		close(t.idle)
+		t.idle = nil
 	}
 }
@@ -0,0 +1,120 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Roles carried in the role claim of a token.
+const (
+	RoleAdmin   = "admin"
+	RoleService = "service" // other backend services, e.g. orders
+)
+
+// Claims are the JWT claims the product service reads.
+type Claims struct {
+	jwt.RegisteredClaims
+	Role string `json:"role"`
+}
+
+type claimsKey struct{}
+
+// NewContext returns a copy of ctx carrying claims.
+func NewContext(ctx context.Context, claims *Claims) context.Context {
+	return context.WithValue(ctx, claimsKey{}, claims)
+}
+
+// FromContext returns the claims of the authenticated caller, if there is one.
+func FromContext(ctx context.Context) (*Claims, bool) {
+	claims, ok := ctx.Value(claimsKey{}).(*Claims)
+	return claims, ok
+}
+
+// Key is an HMAC signing key. ID matches the kid header of the tokens signed
+// with it, it may be empty.
+type Key struct {
+	ID     string
+	Secret []byte
+}
+
+// KeySet holds the keys tokens are verified against. Keeping the previous key
+// in the set while issuers move to a new one lets keys rotate without downtime.
+type KeySet []Key
+
+// ParseKeySet parses a comma separated list of keys, each either "kid:secret"
+// or a bare secret.
+func ParseKeySet(s string) (KeySet, error) {
+	var keys KeySet
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		var key Key
+		if id, secret, ok := strings.Cut(entry, ":"); ok {
+			key = Key{ID: id, Secret: []byte(secret)}
+		} else {
+			key = Key{Secret: []byte(entry)}
+		}
+		if len(key.Secret) == 0 {
+			return nil, fmt.Errorf("empty secret for key %q", key.ID)
+		}
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("no keys configured")
+	}
+	return keys, nil
+}
+
+// keyfunc picks the key named by the token's kid, or offers every key when
+// the token does not name one.
+func (ks KeySet) keyfunc(token *jwt.Token) (any, error) {
+	if kid, ok := token.Header["kid"].(string); ok && kid != "" {
+		for _, key := range ks {
+			if key.ID == kid {
+				return key.Secret, nil
+			}
+		}
+		return nil, fmt.Errorf("unknown key %q", kid)
+	}
+
+	set := jwt.VerificationKeySet{}
+	for _, key := range ks {
+		set.Keys = append(set.Keys, key.Secret)
+	}
+	return set, nil
+}
+
+// Verifier checks bearer tokens.
+type Verifier struct {
+	keys   KeySet
+	parser *jwt.Parser
+}
+
+// NewVerifier returns a verifier for tokens signed with one of keys. A
+// non-empty issuer must match the iss claim.
+func NewVerifier(keys KeySet, issuer string) *Verifier {
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{"HS256", "HS384", "HS512"}),
+		jwt.WithExpirationRequired(),
+	}
+	if issuer != "" {
+		opts = append(opts, jwt.WithIssuer(issuer))
+	}
+	return &Verifier{keys: keys, parser: jwt.NewParser(opts...)}
+}
+
+// Verify parses token and returns its claims if the signature and the
+// registered claims are valid.
+func (v *Verifier) Verify(token string) (*Claims, error) {
+	claims := &Claims{}
+	if _, err := v.parser.ParseWithClaims(token, claims, v.keys.keyfunc); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
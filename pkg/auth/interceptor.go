@@ -0,0 +1,128 @@
+package auth
+
+import (
+	"context"
+	"slices"
+	"strings"
+
+	"github.com/Manuelmastro/mobilehub-product/v3/pkg/pb"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// errorDomain matches the ErrorInfo domain of the service's own errors.
+const errorDomain = "product.mobilehub"
+
+// Interceptor authenticates calls with the bearer token in the authorization
+// metadata and enforces a per-method role policy.
+type Interceptor struct {
+	verifier *Verifier
+	policy   Policy
+}
+
+func NewInterceptor(verifier *Verifier, policy Policy) *Interceptor {
+	return &Interceptor{verifier: verifier, policy: policy}
+}
+
+// Unary returns the interceptor for unary RPCs.
+func (i *Interceptor) Unary() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		ctx, err := i.authorize(ctx, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// Stream returns the interceptor for streaming RPCs.
+func (i *Interceptor) Stream() grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := i.authorize(ss.Context(), info.FullMethod)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+// authorize checks the caller against the rule of method and returns a
+// context carrying the caller's claims. A token sent to a public method still
+// has to be valid. Methods missing from the policy are denied.
+func (i *Interceptor) authorize(ctx context.Context, method string) (context.Context, error) {
+	rule, ok := i.policy[method]
+	if !ok {
+		return nil, authError(codes.PermissionDenied, pb.ErrorReason_PERMISSION_DENIED, "method is not allowed")
+	}
+
+	token, found := bearerToken(ctx)
+	if !found {
+		if rule.Public() {
+			return ctx, nil
+		}
+		return nil, authError(codes.Unauthenticated, pb.ErrorReason_UNAUTHENTICATED, "missing bearer token")
+	}
+
+	claims, err := i.verifier.Verify(token)
+	if err != nil {
+		return nil, authError(codes.Unauthenticated, pb.ErrorReason_UNAUTHENTICATED, "invalid bearer token")
+	}
+	if !rule.Allows(claims.Role) {
+		return nil, authError(codes.PermissionDenied, pb.ErrorReason_PERMISSION_DENIED, "role may not call this method")
+	}
+	return NewContext(ctx, claims), nil
+}
+
+// bearerToken reads the token from the "authorization: Bearer <token>" metadata.
+func bearerToken(ctx context.Context) (string, bool) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return "", false
+	}
+	values := md.Get("authorization")
+	if len(values) == 0 {
+		return "", false
+	}
+	scheme, token, ok := strings.Cut(values[0], " ")
+	if !ok || !strings.EqualFold(scheme, "bearer") {
+		// A malformed header is a bad token, not an anonymous call.
+		return values[0], true
+	}
+	return strings.TrimSpace(token), true
+}
+
+func authError(code codes.Code, reason pb.ErrorReason, msg string) error {
+	st := status.New(code, msg)
+	withDetails, err := st.WithDetails(&errdetails.ErrorInfo{
+		Reason: reason.String(),
+		Domain: errorDomain,
+	})
+	if err != nil {
+		return st.Err()
+	}
+	return withDetails.Err()
+}
+
+// serverStream overrides the context of a stream with the authorized one.
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+// Rule lists the roles allowed to call a method. An empty rule is public.
+type Rule []string
+
+func (r Rule) Public() bool {
+	return len(r) == 0
+}
+
+func (r Rule) Allows(role string) bool {
+	return r.Public() || slices.Contains(r, role)
+}
@@ -0,0 +1,95 @@
+package auth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Manuelmastro/mobilehub-product/v3/pkg/pb"
+	"github.com/golang-jwt/jwt/v5"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func sign(t *testing.T, kid, secret, role string, expires time.Time) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   "user-1",
+			ExpiresAt: jwt.NewNumericDate(expires),
+		},
+		Role: role,
+	})
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString([]byte(secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestInterceptorPolicy(t *testing.T) {
+	keys, err := ParseKeySet("current:new-secret, old-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	unary := NewInterceptor(NewVerifier(keys, ""), ProductServicePolicy).Unary()
+
+	hour := time.Now().Add(time.Hour)
+	admin := sign(t, "current", "new-secret", RoleAdmin, hour)
+	service := sign(t, "", "old-secret", RoleService, hour)
+
+	tests := []struct {
+		name   string
+		method string
+		header string
+		want   codes.Code
+	}{
+		{"public read without token", pb.ProductService_GetProducts_FullMethodName, "", codes.OK},
+		{"health check without token", healthpb.Health_Check_FullMethodName, "", codes.OK},
+		{"admin RPC without token", pb.ProductService_AddProduct_FullMethodName, "", codes.Unauthenticated},
+		{"admin RPC as admin", pb.ProductService_AddProduct_FullMethodName, "Bearer " + admin, codes.OK},
+		{"admin RPC as service", pb.ProductService_DeleteProduct_FullMethodName, "Bearer " + service, codes.PermissionDenied},
+		{"stock RPC as service with old key", pb.ProductService_ReduceStock_FullMethodName, "Bearer " + service, codes.OK},
+		{"stock RPC as admin", pb.ProductService_ReduceStock_FullMethodName, "Bearer " + admin, codes.PermissionDenied},
+		{"wrong key", pb.ProductService_AddProduct_FullMethodName, "Bearer " + sign(t, "", "other", RoleAdmin, hour), codes.Unauthenticated},
+		{"unknown kid", pb.ProductService_AddProduct_FullMethodName, "Bearer " + sign(t, "gone", "new-secret", RoleAdmin, hour), codes.Unauthenticated},
+		{"expired", pb.ProductService_AddProduct_FullMethodName, "Bearer " + sign(t, "current", "new-secret", RoleAdmin, time.Now().Add(-time.Minute)), codes.Unauthenticated},
+		{"bad token on public read", pb.ProductService_GetProduct_FullMethodName, "Bearer garbage", codes.Unauthenticated},
+		{"method missing from policy", "/product.ProductService/Unknown", "Bearer " + admin, codes.PermissionDenied},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.header != "" {
+				ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("authorization", tt.header))
+			}
+
+			var claims *Claims
+			handler := func(ctx context.Context, req any) (any, error) {
+				claims, _ = FromContext(ctx)
+				return nil, nil
+			}
+			_, err := unary(ctx, nil, &grpc.UnaryServerInfo{FullMethod: tt.method}, handler)
+			if got := status.Code(err); got != tt.want {
+				t.Fatalf("got %v, want %v", err, tt.want)
+			}
+			if tt.want == codes.OK && tt.header != "" && (claims == nil || claims.Subject != "user-1") {
+				t.Errorf("handler got claims %+v, want subject user-1", claims)
+			}
+		})
+	}
+}
+
+func TestParseKeySet(t *testing.T) {
+	for _, s := range []string{"", " , ", "kid:"} {
+		if _, err := ParseKeySet(s); err == nil {
+			t.Errorf("ParseKeySet(%q) succeeded, want error", s)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package auth
+
+import (
+	"github.com/Manuelmastro/mobilehub-product/v3/pkg/pb"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// Policy maps full gRPC method names to the roles allowed to call them.
+type Policy map[string]Rule
+
+var (
+	public      = Rule{}
+	adminOnly   = Rule{RoleAdmin}
+	serviceOnly = Rule{RoleService}
+)
+
+// ProductServicePolicy is the access policy of the product service: catalogue
+// reads are public, catalogue changes are for admins and stock changes for
+// the services that sell it. Health checks are public so the orchestrator
+// needs no token. RPCs added to the service must be added here, anything
+// missing is denied.
+var ProductServicePolicy = Policy{
+	pb.ProductService_GetProducts_FullMethodName:          public,
+	pb.ProductService_ViewProducts_FullMethodName:         public,
+	pb.ProductService_GetProduct_FullMethodName:           public,
+	pb.ProductService_GetCategory_FullMethodName:          public,
+	pb.ProductService_GetCategoryTree_FullMethodName:      public,
+	pb.ProductService_ListFeaturedProducts_FullMethodName: public,
+	pb.ProductService_ListPopularProducts_FullMethodName:  public,
+	healthpb.Health_Check_FullMethodName:                  public,
+	healthpb.Health_Watch_FullMethodName:                  public,
+
+	pb.ProductService_AddProduct_FullMethodName:          adminOnly,
+	pb.ProductService_EditProduct_FullMethodName:         adminOnly,
+	pb.ProductService_DeleteProduct_FullMethodName:       adminOnly,
+	pb.ProductService_ListDeletedProducts_FullMethodName: adminOnly,
+	pb.ProductService_RestoreProduct_FullMethodName:      adminOnly,
+	pb.ProductService_PurgeProduct_FullMethodName:        adminOnly,
+	pb.ProductService_ListStockMovements_FullMethodName:  adminOnly,
+	pb.ProductService_CreateCategory_FullMethodName:      adminOnly,
+	pb.ProductService_UpdateCategory_FullMethodName:      adminOnly,
+	pb.ProductService_DeleteCategory_FullMethodName:      adminOnly,
+	pb.ProductService_AddVariant_FullMethodName:          adminOnly,
+	pb.ProductService_UpdateVariant_FullMethodName:       adminOnly,
+	pb.ProductService_DeleteVariant_FullMethodName:       adminOnly,
+	pb.ProductService_CreateOffer_FullMethodName:         adminOnly,
+	pb.ProductService_ListOffers_FullMethodName:          adminOnly,
+	pb.ProductService_DeleteOffer_FullMethodName:         adminOnly,
+	pb.ProductService_SetProductFeatured_FullMethodName:  adminOnly,
+
+	pb.ProductService_ReduceStock_FullMethodName:        serviceOnly,
+	pb.ProductService_BatchReduceStock_FullMethodName:   serviceOnly,
+	pb.ProductService_ReserveStock_FullMethodName:       serviceOnly,
+	pb.ProductService_CommitReservation_FullMethodName:  serviceOnly,
+	pb.ProductService_ReleaseReservation_FullMethodName: serviceOnly,
+	pb.ProductService_RestoreStock_FullMethodName:       serviceOnly,
+}
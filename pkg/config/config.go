@@ -1,10 +1,39 @@
 package config
 
-import "github.com/spf13/viper"
+import (
+	"fmt"
+	"time"
+
+	"github.com/spf13/viper"
+)
 
 type Config struct {
 	Port  string `mapstructure:"PORT"`
 	DBUrl string `mapstructure:"DB_URL"`
+
+	MigrateOnStart bool `mapstructure:"MIGRATE_ON_START"` // apply pending migrations before serving
+
+	JWTKeys   string `mapstructure:"JWT_KEYS"`   // comma separated, "kid:secret" or bare secrets
+	JWTIssuer string `mapstructure:"JWT_ISSUER"` // checked against the iss claim when set
+
+	Currency string `mapstructure:"CURRENCY"`
+
+	ReservationTTL           time.Duration `mapstructure:"RESERVATION_TTL"`
+	ReservationSweepInterval time.Duration `mapstructure:"RESERVATION_SWEEP_INTERVAL"`
+
+	IdempotencyKeyTTL             time.Duration `mapstructure:"IDEMPOTENCY_KEY_TTL"`
+	IdempotencyKeyCleanupInterval time.Duration `mapstructure:"IDEMPOTENCY_KEY_CLEANUP_INTERVAL"`
+
+	DeletedProductRetentionDays int           `mapstructure:"DELETED_PRODUCT_RETENTION_DAYS"` // 0 keeps deleted products forever
+	DeletedProductPurgeInterval time.Duration `mapstructure:"DELETED_PRODUCT_PURGE_INTERVAL"`
+
+	PopularityWindow          time.Duration `mapstructure:"POPULARITY_WINDOW"` // sales this recent rank popular products
+	PopularityRefreshInterval time.Duration `mapstructure:"POPULARITY_REFRESH_INTERVAL"`
+
+	HealthCheckInterval    time.Duration `mapstructure:"HEALTH_CHECK_INTERVAL"`    // how often the database is pinged
+	HealthFailureThreshold int           `mapstructure:"HEALTH_FAILURE_THRESHOLD"` // failed pings in a row before NOT_SERVING
+
+	ShutdownTimeout time.Duration `mapstructure:"SHUTDOWN_TIMEOUT"` // how long running RPCs may finish on SIGTERM
 }
 
 func LoadConfig() (config Config, err error) {
@@ -12,6 +41,20 @@ func LoadConfig() (config Config, err error) {
 	viper.SetConfigName("dev")
 	viper.SetConfigType("env")
 
+	viper.SetDefault("MIGRATE_ON_START", false)
+	viper.SetDefault("CURRENCY", "INR")
+	viper.SetDefault("RESERVATION_TTL", "15m")
+	viper.SetDefault("RESERVATION_SWEEP_INTERVAL", "1m")
+	viper.SetDefault("IDEMPOTENCY_KEY_TTL", "24h")
+	viper.SetDefault("IDEMPOTENCY_KEY_CLEANUP_INTERVAL", "1h")
+	viper.SetDefault("DELETED_PRODUCT_RETENTION_DAYS", 30)
+	viper.SetDefault("DELETED_PRODUCT_PURGE_INTERVAL", "1h")
+	viper.SetDefault("POPULARITY_WINDOW", "168h")
+	viper.SetDefault("POPULARITY_REFRESH_INTERVAL", "1h")
+	viper.SetDefault("HEALTH_CHECK_INTERVAL", "10s")
+	viper.SetDefault("HEALTH_FAILURE_THRESHOLD", 3)
+	viper.SetDefault("SHUTDOWN_TIMEOUT", "30s")
+
 	viper.AutomaticEnv()
 
 	err = viper.ReadInConfig()
@@ -22,5 +65,35 @@ func LoadConfig() (config Config, err error) {
 
 	err = viper.Unmarshal(&config)
 
+	if err != nil {
+		return
+	}
+
+	err = config.validate()
+
 	return
 }
+
+// validate rejects the settings the service cannot start with. The intervals
+// drive tickers, which need a positive period.
+func (c Config) validate() error {
+	type interval struct {
+		name  string
+		value time.Duration
+	}
+	intervals := []interval{
+		{"RESERVATION_SWEEP_INTERVAL", c.ReservationSweepInterval},
+		{"IDEMPOTENCY_KEY_CLEANUP_INTERVAL", c.IdempotencyKeyCleanupInterval},
+		{"POPULARITY_REFRESH_INTERVAL", c.PopularityRefreshInterval},
+		{"HEALTH_CHECK_INTERVAL", c.HealthCheckInterval},
+	}
+	if c.DeletedProductRetentionDays > 0 {
+		intervals = append(intervals, interval{"DELETED_PRODUCT_PURGE_INTERVAL", c.DeletedProductPurgeInterval})
+	}
+	for _, i := range intervals {
+		if i.value <= 0 {
+			return fmt.Errorf("%s must be a positive duration, got %s", i.name, i.value)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+package db
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"gorm.io/gorm"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	fsys := fstest.MapFS{
+		"0002_b.up.sql":   {Data: []byte("up 2")},
+		"0002_b.down.sql": {Data: []byte("down 2")},
+		"0001_a.up.sql":   {Data: []byte("up 1")},
+		"0001_a.down.sql": {Data: []byte("down 1")},
+	}
+	migrations, err := loadMigrations(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migrations) != 2 || migrations[0].Name != "a" || migrations[1].Down != "down 2" {
+		t.Fatalf("migrations = %+v, want a then b", migrations)
+	}
+
+	for name, fsys := range map[string]fstest.MapFS{
+		"missing down": {"0001_a.up.sql": {Data: []byte("up")}},
+		"bad name":     {"1-a.sql": {Data: []byte("up")}},
+		"two names": {
+			"0001_a.up.sql":   {Data: []byte("up")},
+			"0001_b.down.sql": {Data: []byte("down")},
+		},
+	} {
+		if _, err := loadMigrations(fsys); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestEmbeddedMigrations(t *testing.T) {
+	postgres, err := NewMigrator(nil, dialectPostgres)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, migration := range postgres.migrations {
+		if migration.Version != int64(i+1) {
+			t.Errorf("migration %d_%s: versions must count up from 1 without gaps", migration.Version, migration.Name)
+		}
+	}
+
+	sqlite, err := NewMigrator(nil, dialectSQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sqlite.migrations) != len(postgres.migrations) {
+		t.Fatalf("%d sqlite migrations, want one for each of the %d postgres ones", len(sqlite.migrations), len(postgres.migrations))
+	}
+	for i, migration := range sqlite.migrations {
+		if want := postgres.migrations[i]; migration.Version != want.Version || migration.Name != want.Name {
+			t.Errorf("sqlite migration %d_%s, want %d_%s", migration.Version, migration.Name, want.Version, want.Name)
+		}
+	}
+}
+
+func TestOpenScheme(t *testing.T) {
+	for _, url := range []string{"mysql://localhost/products", "sqlite://"} {
+		if _, err := Open(url); err == nil {
+			t.Errorf("Open(%q): expected error", url)
+		}
+	}
+
+	gormDB, err := Open("sqlite://:memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name := gormDB.Dialector.Name(); name != dialectSQLite {
+		t.Errorf("dialect = %q, want %q", name, dialectSQLite)
+	}
+}
+
+// Connect reports what Init would exit on.
+func TestConnectReportsErrors(t *testing.T) {
+	dir := t.TempDir()
+	for _, c := range []struct {
+		url     string
+		migrate bool
+	}{
+		{"mysql://localhost/products", true},
+		{"sqlite://" + filepath.Join(dir, "missing", "product.db"), true},
+		{"sqlite://" + filepath.Join(dir, "product.db"), false}, // schema behind the binary
+	} {
+		if _, err := Connect(c.url, c.migrate); err == nil {
+			t.Errorf("Connect(%q, %t): expected error", c.url, c.migrate)
+		}
+	}
+
+	h, err := Connect("sqlite://"+filepath.Join(dir, "product.db"), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sqlDB, err := h.DB.DB(); err == nil {
+		sqlDB.Close()
+	}
+}
+
+// TestMigrateUpDown runs every migration down and up again on an in-memory
+// SQLite database, and on PostgreSQL when TEST_MIGRATE_DB_URL names a
+// database of its own.
+func TestMigrateUpDown(t *testing.T) {
+	urls := []string{"sqlite://:memory:"}
+	if url := os.Getenv("TEST_MIGRATE_DB_URL"); url != "" {
+		urls = append(urls, url)
+	}
+	for _, url := range urls {
+		gormDB, err := Open(url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Run(gormDB.Dialector.Name(), func(t *testing.T) {
+			testMigrateUpDown(t, gormDB)
+		})
+	}
+}
+
+func testMigrateUpDown(t *testing.T, gormDB *gorm.DB) {
+	sqlDB, err := gormDB.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sqlDB.Close()
+	m, err := NewMigrator(sqlDB, gormDB.Dialector.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	if _, err := m.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+	reverted, err := m.Down(ctx, len(m.migrations))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reverted) != len(m.migrations) {
+		t.Fatalf("reverted %d migrations, want %d", len(reverted), len(m.migrations))
+	}
+	if err := m.CheckCurrent(ctx); err == nil || !strings.Contains(err.Error(), "0001_create_products") {
+		t.Fatalf("CheckCurrent after down = %v, want every migration pending", err)
+	}
+
+	applied, err := m.Up(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != len(m.migrations) {
+		t.Fatalf("applied %d migrations, want %d", len(applied), len(m.migrations))
+	}
+	if err := m.CheckCurrent(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
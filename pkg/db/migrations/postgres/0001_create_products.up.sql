@@ -0,0 +1,16 @@
+-- The products table as the service created it before versioned migrations,
+-- databases from that time already have it.
+CREATE TABLE IF NOT EXISTS products (
+    id bigserial PRIMARY KEY,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    category_name text,
+    product_name text,
+    description text,
+    image_url text,
+    price decimal,
+    stock integer
+);
+
+CREATE INDEX IF NOT EXISTS idx_products_deleted_at ON products (deleted_at);
@@ -0,0 +1,11 @@
+ALTER TABLE products
+    DROP CONSTRAINT chk_products_price_minor,
+    DROP CONSTRAINT chk_products_stock,
+    ADD COLUMN price decimal;
+
+UPDATE products SET price = price_minor / 100.0;
+
+ALTER TABLE products
+    DROP COLUMN version,
+    DROP COLUMN currency,
+    DROP COLUMN price_minor;
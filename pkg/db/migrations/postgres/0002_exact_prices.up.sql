@@ -0,0 +1,21 @@
+ALTER TABLE products
+    ADD COLUMN IF NOT EXISTS price_minor bigint NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS currency varchar(3) NOT NULL DEFAULT 'INR',
+    ADD COLUMN IF NOT EXISTS version bigint NOT NULL DEFAULT 1;
+
+-- Prices move from the float column to minor units (paise).
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM information_schema.columns
+               WHERE table_schema = current_schema() AND table_name = 'products' AND column_name = 'price') THEN
+        UPDATE products SET price_minor = ROUND(price * 100) WHERE price IS NOT NULL;
+        ALTER TABLE products DROP COLUMN price;
+    END IF;
+END
+$$;
+
+-- NOT VALID checks new and updated rows only. Run VALIDATE CONSTRAINT once
+-- older rows are known to comply.
+ALTER TABLE products
+    ADD CONSTRAINT chk_products_stock CHECK (stock >= 0) NOT VALID,
+    ADD CONSTRAINT chk_products_price_minor CHECK (price_minor >= 0) NOT VALID;
@@ -0,0 +1,48 @@
+CREATE TABLE IF NOT EXISTS reservations (
+    id bigserial PRIMARY KEY,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    reference text,
+    status text NOT NULL,
+    expires_at timestamptz NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_reservations_deleted_at ON reservations (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_reservations_status ON reservations (status);
+CREATE INDEX IF NOT EXISTS idx_reservations_expires_at ON reservations (expires_at);
+
+CREATE TABLE IF NOT EXISTS reservation_items (
+    id bigserial PRIMARY KEY,
+    reservation_id bigint NOT NULL,
+    product_id bigint NOT NULL,
+    quantity integer,
+    CONSTRAINT fk_reservations_items FOREIGN KEY (reservation_id) REFERENCES reservations (id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_reservation_items_reservation_id ON reservation_items (reservation_id);
+CREATE INDEX IF NOT EXISTS idx_reservation_items_product_id ON reservation_items (product_id);
+
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    method text,
+    idempotency_key text,
+    request_hash text NOT NULL,
+    response bytea,
+    created_at timestamptz,
+    PRIMARY KEY (method, idempotency_key)
+);
+
+CREATE INDEX IF NOT EXISTS idx_idempotency_keys_created_at ON idempotency_keys (created_at);
+
+CREATE TABLE IF NOT EXISTS stock_movements (
+    id bigserial PRIMARY KEY,
+    product_id bigint NOT NULL,
+    delta integer NOT NULL,
+    balance integer NOT NULL,
+    reason text NOT NULL,
+    reference text,
+    caller text,
+    created_at timestamptz
+);
+
+CREATE INDEX IF NOT EXISTS idx_stock_movements_product_time ON stock_movements (product_id, created_at);
@@ -0,0 +1,7 @@
+ALTER TABLE products ADD COLUMN category_name text;
+
+UPDATE products p SET category_name = c.name FROM categories c WHERE c.id = p.category_id;
+
+ALTER TABLE products DROP COLUMN category_id;
+
+DROP TABLE categories;
@@ -0,0 +1,70 @@
+CREATE TABLE IF NOT EXISTS categories (
+    id bigserial PRIMARY KEY,
+    name varchar(100) NOT NULL,
+    slug varchar(100) NOT NULL,
+    parent_id bigint,
+    sort_order integer NOT NULL DEFAULT 0,
+    created_at timestamptz,
+    updated_at timestamptz,
+    CONSTRAINT fk_categories_children FOREIGN KEY (parent_id) REFERENCES categories (id)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_categories_slug ON categories (slug);
+CREATE INDEX IF NOT EXISTS idx_categories_parent_id ON categories (parent_id);
+
+ALTER TABLE products ADD COLUMN IF NOT EXISTS category_id bigint;
+
+CREATE INDEX IF NOT EXISTS idx_products_category_id ON products (category_id);
+
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'fk_products_category') THEN
+        ALTER TABLE products ADD CONSTRAINT fk_products_category FOREIGN KEY (category_id) REFERENCES categories (id);
+    END IF;
+END
+$$;
+
+-- The free-text category_name of products becomes category rows. Spellings
+-- that differ only in case, spacing, accents or punctuation, like
+-- "Smartphones" and "Smart Phones", become one category named after the
+-- spelling most products used. Slugs are made the way pkg/slug makes them,
+-- normalize needs PostgreSQL 13 or later.
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM information_schema.columns
+                   WHERE table_schema = current_schema() AND table_name = 'products' AND column_name = 'category_name') THEN
+        RETURN;
+    END IF;
+
+    CREATE TEMPORARY TABLE category_spellings ON COMMIT DROP AS
+    SELECT category_name AS name,
+           COUNT(*) AS uses,
+           trim(BOTH '-' FROM regexp_replace(
+               regexp_replace(lower(normalize(category_name, NFKD)), '[\u0300-\u036f]', '', 'g'),
+               '[^a-z0-9]+', '-', 'g')) AS slug
+    FROM products
+    WHERE category_name IS NOT NULL AND trim(category_name) <> ''
+    GROUP BY category_name;
+
+    CREATE TEMPORARY TABLE category_groups ON COMMIT DROP AS
+    SELECT DISTINCT ON (replace(slug, '-', ''))
+           replace(slug, '-', '') AS spelling,
+           trim(name) AS name,
+           COALESCE(NULLIF(slug, ''), 'uncategorized') AS slug -- nothing but punctuation
+    FROM category_spellings
+    ORDER BY replace(slug, '-', ''), uses DESC, name COLLATE "C";
+
+    INSERT INTO categories (name, slug, created_at, updated_at)
+    SELECT name, slug, now(), now() FROM category_groups
+    ON CONFLICT (slug) DO NOTHING;
+
+    UPDATE products p
+    SET category_id = c.id
+    FROM category_spellings s
+    JOIN category_groups g ON g.spelling = replace(s.slug, '-', '')
+    JOIN categories c ON c.slug = g.slug
+    WHERE p.category_name = s.name;
+
+    ALTER TABLE products DROP COLUMN category_name;
+END
+$$;
@@ -0,0 +1,39 @@
+CREATE TABLE IF NOT EXISTS variants (
+    id bigserial PRIMARY KEY,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    product_id bigint NOT NULL,
+    sku varchar(64) NOT NULL,
+    price_minor bigint NOT NULL DEFAULT 0,
+    currency varchar(3) NOT NULL DEFAULT 'INR',
+    stock integer NOT NULL DEFAULT 0,
+    image_url text,
+    CONSTRAINT chk_variants_stock CHECK (stock >= 0),
+    CONSTRAINT chk_variants_price_minor CHECK (price_minor >= 0)
+);
+
+CREATE INDEX IF NOT EXISTS idx_variants_deleted_at ON variants (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_variants_product_id ON variants (product_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_variants_sku ON variants (sku) WHERE deleted_at IS NULL;
+
+CREATE TABLE IF NOT EXISTS variant_options (
+    id bigserial PRIMARY KEY,
+    variant_id bigint NOT NULL,
+    position integer NOT NULL DEFAULT 0,
+    name varchar(50) NOT NULL,
+    value varchar(100) NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_variant_options_variant_id ON variant_options (variant_id);
+
+-- Purging a product takes its variants and their options with it.
+ALTER TABLE variants
+    DROP CONSTRAINT IF EXISTS fk_products_variants,
+    ADD CONSTRAINT fk_products_variants FOREIGN KEY (product_id) REFERENCES products (id) ON DELETE CASCADE;
+ALTER TABLE variant_options
+    DROP CONSTRAINT IF EXISTS fk_variants_options,
+    ADD CONSTRAINT fk_variants_options FOREIGN KEY (variant_id) REFERENCES variants (id) ON DELETE CASCADE;
+
+ALTER TABLE reservation_items ADD COLUMN IF NOT EXISTS variant_id bigint NOT NULL DEFAULT 0;
+ALTER TABLE stock_movements ADD COLUMN IF NOT EXISTS variant_id bigint NOT NULL DEFAULT 0;
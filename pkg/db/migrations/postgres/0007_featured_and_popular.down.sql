@@ -0,0 +1,3 @@
+ALTER TABLE products
+    DROP COLUMN recent_sales,
+    DROP COLUMN featured_rank;
@@ -0,0 +1,6 @@
+ALTER TABLE products
+    ADD COLUMN IF NOT EXISTS featured_rank integer,
+    ADD COLUMN IF NOT EXISTS recent_sales bigint NOT NULL DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS idx_products_featured_rank ON products (featured_rank);
+CREATE INDEX IF NOT EXISTS idx_products_recent_sales ON products (recent_sales);
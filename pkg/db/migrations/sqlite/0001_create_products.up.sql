@@ -0,0 +1,16 @@
+-- AUTOINCREMENT keeps SQLite from handing out the id of a purged product
+-- again, like the PostgreSQL sequences.
+CREATE TABLE IF NOT EXISTS products (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    created_at datetime,
+    updated_at datetime,
+    deleted_at datetime,
+    category_name text,
+    product_name text,
+    description text,
+    image_url text,
+    price numeric,
+    stock integer
+);
+
+CREATE INDEX IF NOT EXISTS idx_products_deleted_at ON products (deleted_at);
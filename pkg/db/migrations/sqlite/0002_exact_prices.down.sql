@@ -0,0 +1,21 @@
+CREATE TABLE products_old (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    created_at datetime,
+    updated_at datetime,
+    deleted_at datetime,
+    category_name text,
+    product_name text,
+    description text,
+    image_url text,
+    price numeric,
+    stock integer
+);
+
+INSERT INTO products_old (id, created_at, updated_at, deleted_at, category_name, product_name, description, image_url, price, stock)
+SELECT id, created_at, updated_at, deleted_at, category_name, product_name, description, image_url, price_minor / 100.0, stock
+FROM products;
+
+DROP TABLE products;
+ALTER TABLE products_old RENAME TO products;
+
+CREATE INDEX IF NOT EXISTS idx_products_deleted_at ON products (deleted_at);
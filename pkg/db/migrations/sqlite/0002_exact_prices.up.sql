@@ -0,0 +1,27 @@
+-- SQLite cannot add checks to a table, it is rebuilt with them. Prices move
+-- from the float column to minor units (paise).
+CREATE TABLE products_new (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    created_at datetime,
+    updated_at datetime,
+    deleted_at datetime,
+    category_name text,
+    product_name text,
+    description text,
+    image_url text,
+    price_minor bigint NOT NULL DEFAULT 0,
+    currency varchar(3) NOT NULL DEFAULT 'INR',
+    version bigint NOT NULL DEFAULT 1,
+    stock integer,
+    CONSTRAINT chk_products_stock CHECK (stock >= 0),
+    CONSTRAINT chk_products_price_minor CHECK (price_minor >= 0)
+);
+
+INSERT INTO products_new (id, created_at, updated_at, deleted_at, category_name, product_name, description, image_url, price_minor, stock)
+SELECT id, created_at, updated_at, deleted_at, category_name, product_name, description, image_url, COALESCE(ROUND(price * 100), 0), stock
+FROM products;
+
+DROP TABLE products;
+ALTER TABLE products_new RENAME TO products;
+
+CREATE INDEX IF NOT EXISTS idx_products_deleted_at ON products (deleted_at);
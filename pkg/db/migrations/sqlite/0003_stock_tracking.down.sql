@@ -0,0 +1,4 @@
+DROP TABLE stock_movements;
+DROP TABLE idempotency_keys;
+DROP TABLE reservation_items;
+DROP TABLE reservations;
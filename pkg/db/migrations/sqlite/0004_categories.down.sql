@@ -0,0 +1,28 @@
+-- SQLite cannot drop a column with a foreign key, the table is rebuilt.
+CREATE TABLE products_old (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    created_at datetime,
+    updated_at datetime,
+    deleted_at datetime,
+    category_name text,
+    product_name text,
+    description text,
+    image_url text,
+    price_minor bigint NOT NULL DEFAULT 0,
+    currency varchar(3) NOT NULL DEFAULT 'INR',
+    version bigint NOT NULL DEFAULT 1,
+    stock integer,
+    CONSTRAINT chk_products_stock CHECK (stock >= 0),
+    CONSTRAINT chk_products_price_minor CHECK (price_minor >= 0)
+);
+
+INSERT INTO products_old (id, created_at, updated_at, deleted_at, category_name, product_name, description, image_url, price_minor, currency, version, stock)
+SELECT p.id, p.created_at, p.updated_at, p.deleted_at, c.name, p.product_name, p.description, p.image_url, p.price_minor, p.currency, p.version, p.stock
+FROM products p LEFT JOIN categories c ON c.id = p.category_id;
+
+DROP TABLE products;
+ALTER TABLE products_old RENAME TO products;
+
+CREATE INDEX IF NOT EXISTS idx_products_deleted_at ON products (deleted_at);
+
+DROP TABLE categories;
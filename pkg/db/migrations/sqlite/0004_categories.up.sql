@@ -0,0 +1,35 @@
+CREATE TABLE IF NOT EXISTS categories (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    name varchar(100) NOT NULL,
+    slug varchar(100) NOT NULL,
+    parent_id bigint,
+    sort_order integer NOT NULL DEFAULT 0,
+    created_at datetime,
+    updated_at datetime,
+    CONSTRAINT fk_categories_children FOREIGN KEY (parent_id) REFERENCES categories (id)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_categories_slug ON categories (slug);
+CREATE INDEX IF NOT EXISTS idx_categories_parent_id ON categories (parent_id);
+
+ALTER TABLE products ADD COLUMN category_id bigint CONSTRAINT fk_products_category REFERENCES categories (id);
+
+CREATE INDEX IF NOT EXISTS idx_products_category_id ON products (category_id);
+
+-- The free-text category_name of products becomes category rows. SQLite has
+-- no regular expressions or Unicode normalization, so unlike the PostgreSQL
+-- migration only spellings that differ in case or surrounding spaces become
+-- one category, and slugs only have their spaces replaced. Fix up the rest
+-- with UpdateCategory.
+INSERT INTO categories (name, slug, created_at, updated_at)
+SELECT MIN(trim(category_name)), replace(lower(trim(category_name)), ' ', '-'), CURRENT_TIMESTAMP, CURRENT_TIMESTAMP
+FROM products
+WHERE category_name IS NOT NULL AND trim(category_name) <> ''
+GROUP BY replace(lower(trim(category_name)), ' ', '-')
+ON CONFLICT (slug) DO NOTHING;
+
+UPDATE products
+SET category_id = (SELECT c.id FROM categories c WHERE c.slug = replace(lower(trim(products.category_name)), ' ', '-'))
+WHERE category_name IS NOT NULL;
+
+ALTER TABLE products DROP COLUMN category_name;
@@ -0,0 +1,5 @@
+ALTER TABLE stock_movements DROP COLUMN variant_id;
+ALTER TABLE reservation_items DROP COLUMN variant_id;
+
+DROP TABLE variant_options;
+DROP TABLE variants;
@@ -0,0 +1,34 @@
+-- Purging a product takes its variants and their options with it.
+CREATE TABLE IF NOT EXISTS variants (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    created_at datetime,
+    updated_at datetime,
+    deleted_at datetime,
+    product_id bigint NOT NULL,
+    sku varchar(64) NOT NULL,
+    price_minor bigint NOT NULL DEFAULT 0,
+    currency varchar(3) NOT NULL DEFAULT 'INR',
+    stock integer NOT NULL DEFAULT 0,
+    image_url text,
+    CONSTRAINT chk_variants_stock CHECK (stock >= 0),
+    CONSTRAINT chk_variants_price_minor CHECK (price_minor >= 0),
+    CONSTRAINT fk_products_variants FOREIGN KEY (product_id) REFERENCES products (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_variants_deleted_at ON variants (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_variants_product_id ON variants (product_id);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_variants_sku ON variants (sku) WHERE deleted_at IS NULL;
+
+CREATE TABLE IF NOT EXISTS variant_options (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    variant_id bigint NOT NULL,
+    position integer NOT NULL DEFAULT 0,
+    name varchar(50) NOT NULL,
+    value varchar(100) NOT NULL,
+    CONSTRAINT fk_variants_options FOREIGN KEY (variant_id) REFERENCES variants (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_variant_options_variant_id ON variant_options (variant_id);
+
+ALTER TABLE reservation_items ADD COLUMN variant_id bigint NOT NULL DEFAULT 0;
+ALTER TABLE stock_movements ADD COLUMN variant_id bigint NOT NULL DEFAULT 0;
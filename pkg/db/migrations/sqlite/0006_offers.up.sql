@@ -0,0 +1,23 @@
+CREATE TABLE IF NOT EXISTS offers (
+    id integer PRIMARY KEY AUTOINCREMENT,
+    name varchar(100) NOT NULL,
+    product_id bigint,
+    category_id bigint,
+    kind varchar(10) NOT NULL,
+    percent_off integer NOT NULL DEFAULT 0,
+    amount_off_minor bigint NOT NULL DEFAULT 0,
+    currency varchar(3),
+    starts_at datetime NOT NULL,
+    ends_at datetime,
+    created_at datetime,
+    updated_at datetime,
+    CONSTRAINT chk_offers_target CHECK ((product_id IS NULL) <> (category_id IS NULL)),
+    CONSTRAINT chk_offers_kind CHECK (kind IN ('percent', 'amount')),
+    CONSTRAINT chk_offers_percent_off CHECK (percent_off BETWEEN 0 AND 100),
+    CONSTRAINT chk_offers_amount_off CHECK (amount_off_minor >= 0),
+    CONSTRAINT chk_offers_period CHECK (ends_at IS NULL OR ends_at > starts_at)
+);
+
+CREATE INDEX IF NOT EXISTS idx_offers_product_id ON offers (product_id);
+CREATE INDEX IF NOT EXISTS idx_offers_category_id ON offers (category_id);
+CREATE INDEX IF NOT EXISTS idx_offers_starts_at ON offers (starts_at);
@@ -0,0 +1,6 @@
+-- SQLite cannot drop indexed columns.
+DROP INDEX idx_products_recent_sales;
+DROP INDEX idx_products_featured_rank;
+
+ALTER TABLE products DROP COLUMN recent_sales;
+ALTER TABLE products DROP COLUMN featured_rank;
@@ -0,0 +1,5 @@
+ALTER TABLE products ADD COLUMN featured_rank integer;
+ALTER TABLE products ADD COLUMN recent_sales bigint NOT NULL DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS idx_products_featured_rank ON products (featured_rank);
+CREATE INDEX IF NOT EXISTS idx_products_recent_sales ON products (recent_sales);
@@ -0,0 +1,90 @@
+// Package health reports over grpc.health.v1 whether the service can serve,
+// which it can while its database answers.
+package health
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// pingTimeout bounds one database ping, a hung connection counts as a
+// failure.
+const pingTimeout = 5 * time.Second
+
+// Pinger is the database connection being watched, *sql.DB is one.
+type Pinger interface {
+	PingContext(ctx context.Context) error
+}
+
+// Monitor keeps the statuses of a health server in step with the database.
+// Every service starts NOT_SERVING, turns SERVING once a ping succeeds and
+// back to NOT_SERVING after failureThreshold pings in a row fail, or for good
+// at shutdown.
+type Monitor struct {
+	server           *health.Server
+	db               Pinger
+	services         []string
+	failureThreshold int
+
+	mu       sync.Mutex
+	failures int
+}
+
+// NewMonitor watches db on behalf of services, the overall status of the
+// server under "" is always reported as well.
+func NewMonitor(db Pinger, failureThreshold int, services ...string) *Monitor {
+	if failureThreshold < 1 {
+		failureThreshold = 1
+	}
+	m := &Monitor{
+		server:           health.NewServer(),
+		db:               db,
+		services:         append([]string{""}, services...),
+		failureThreshold: failureThreshold,
+	}
+	m.set(healthpb.HealthCheckResponse_NOT_SERVING)
+	return m
+}
+
+// Server is the grpc.health.v1.Health implementation to register.
+func (m *Monitor) Server() *health.Server {
+	return m.server
+}
+
+// Check pings the database once and updates the statuses. It returns the
+// ping error, so a worker running it logs every failure.
+func (m *Monitor) Check(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, pingTimeout)
+	defer cancel()
+	err := m.db.PingContext(ctx)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err == nil {
+		m.failures = 0
+		m.set(healthpb.HealthCheckResponse_SERVING)
+		return nil
+	}
+	m.failures++
+	if m.failures >= m.failureThreshold {
+		m.set(healthpb.HealthCheckResponse_NOT_SERVING)
+	}
+	return fmt.Errorf("database ping failed %d times in a row: %w", m.failures, err)
+}
+
+// Shutdown reports NOT_SERVING from now on, whatever later pings say, so
+// clients move to other replicas before the server stops.
+func (m *Monitor) Shutdown() {
+	m.server.Shutdown()
+}
+
+func (m *Monitor) set(status healthpb.HealthCheckResponse_ServingStatus) {
+	for _, service := range m.services {
+		m.server.SetServingStatus(service, status)
+	}
+}
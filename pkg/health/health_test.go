@@ -0,0 +1,60 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// fakeDB answers pings with err.
+type fakeDB struct {
+	err error
+}
+
+func (db *fakeDB) PingContext(context.Context) error {
+	return db.err
+}
+
+func TestMonitor(t *testing.T) {
+	db := &fakeDB{}
+	m := NewMonitor(db, 2, "product.ProductService")
+	ctx := context.Background()
+
+	want := func(step string, status healthpb.HealthCheckResponse_ServingStatus) {
+		t.Helper()
+		for _, service := range []string{"", "product.ProductService"} {
+			res, err := m.Server().Check(ctx, &healthpb.HealthCheckRequest{Service: service})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.Status != status {
+				t.Fatalf("%s: service %q is %v, want %v", step, service, res.Status, status)
+			}
+		}
+	}
+
+	want("before the first ping", healthpb.HealthCheckResponse_NOT_SERVING)
+	if err := m.Check(ctx); err != nil {
+		t.Fatal(err)
+	}
+	want("after a ping", healthpb.HealthCheckResponse_SERVING)
+
+	// One failed ping is tolerated, the second in a row is not.
+	db.err = errors.New("connection refused")
+	if err := m.Check(ctx); err == nil {
+		t.Fatal("expected the ping error")
+	}
+	want("after one failure", healthpb.HealthCheckResponse_SERVING)
+	m.Check(ctx)
+	want("after two failures", healthpb.HealthCheckResponse_NOT_SERVING)
+
+	db.err = nil
+	m.Check(ctx)
+	want("after recovering", healthpb.HealthCheckResponse_SERVING)
+
+	m.Shutdown()
+	m.Check(ctx)
+	want("after shutdown", healthpb.HealthCheckResponse_NOT_SERVING)
+}
@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// Category groups products. Categories form a tree through ParentID, top
+// level categories have none. They are deleted for good, and only once no
+// product or subcategory uses them.
+type Category struct {
+	ID        uint       `gorm:"primaryKey" json:"id"`
+	Name      string     `gorm:"size:100;not null" json:"name"`
+	Slug      string     `gorm:"size:100;uniqueIndex;not null" json:"slug"`
+	ParentID  *uint      `gorm:"index" json:"parent_id"`
+	SortOrder int32      `gorm:"not null;default:0" json:"sort_order"` // siblings are listed by sort order, then name
+	Children  []Category `gorm:"foreignKey:ParentID" json:"-"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// IdempotencyKey records the response of a stock-mutating call so that a
+// retry carrying the same key gets the original response back instead of
+// changing stock a second time.
+type IdempotencyKey struct {
+	Method      string    `gorm:"primaryKey" json:"method"`
+	Key         string    `gorm:"primaryKey;column:idempotency_key" json:"key"`
+	RequestHash string    `gorm:"not null" json:"request_hash"`
+	Response    []byte    `json:"response"`
+	CreatedAt   time.Time `gorm:"index" json:"created_at"`
+}
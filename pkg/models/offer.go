@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// Kinds of offers.
+const (
+	OfferPercent = "percent"
+	OfferAmount  = "amount"
+)
+
+// Offer discounts one product, or every product of a category and its
+// subcategories, from StartsAt until EndsAt. Exactly one of ProductID and
+// CategoryID is set.
+type Offer struct {
+	ID             uint       `gorm:"primaryKey" json:"id"`
+	Name           string     `gorm:"size:100;not null" json:"name"`
+	ProductID      *uint      `gorm:"index" json:"product_id"`
+	CategoryID     *uint      `gorm:"index" json:"category_id"`
+	Kind           string     `gorm:"size:10;not null" json:"kind"`
+	PercentOff     int32      `gorm:"not null;default:0" json:"percent_off"`
+	AmountOffMinor int64      `gorm:"not null;default:0" json:"amount_off_minor"`
+	Currency       string     `gorm:"size:3" json:"currency"` // of AmountOffMinor
+	StartsAt       time.Time  `gorm:"not null;index" json:"starts_at"`
+	EndsAt         *time.Time `json:"ends_at"` // nil runs until the offer is deleted
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
@@ -5,17 +5,20 @@ import "gorm.io/gorm"
 type Product struct {
 	gorm.Model
 	//ID uint `gorm:"primary key" json:"id"`
-	//CategoryID  uint     `json:"category_id" validate:"required"`
-	CategoryName string  `json:"category_name"`
-	ProductName  string  `json:"product_name"`
-	Description  string  `json:"product_description"`
-	ImageUrl     string  `json:"product_imageUrl"`
-	Price        float64 `json:"price"`
-	Stock        int32   `json:"stock"`
-	//Popular              bool     `gorm:"type:boolean;default:false" json:"popular" validate:"required"`
+	CategoryID  *uint     `gorm:"index" json:"category_id"`
+	Category    *Category `json:"category,omitempty"`
+	ProductName string    `json:"product_name"`
+	Description string    `json:"product_description"`
+	ImageUrl    string    `json:"product_imageUrl"`
+	PriceMinor  int64     `gorm:"not null;default:0" json:"price_minor"` // price in minor units (paise)
+	Currency    string    `gorm:"size:3;not null;default:'INR'" json:"currency"`
+	Stock       int32     `json:"stock"`
+	Version     int64     `gorm:"not null;default:1" json:"version"` // optimistic lock for admin edits
+	Variants    []Variant `json:"variants,omitempty"`
+
+	FeaturedRank *int32 `gorm:"index" json:"featured_rank"`                   // nil unless featured, lower ranks first
+	RecentSales  int64  `gorm:"not null;default:0;index" json:"recent_sales"` // units sold in the popularity window
 	//Size                 string   `gorm:"type:varchar(10); check:size IN ('Medium', 'Small', 'Large')" json:"size" validate:"required,oneof=Medium Small Large"`
-	//HasOffer             bool `gorm:"default:false"`
-	//OfferDiscountPercent uint `gorm:"default:0"`
 }
 
 ///
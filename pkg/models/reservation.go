@@ -0,0 +1,32 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Reservation states. A pending reservation holds stock until it is
+// committed, released or it expires.
+const (
+	ReservationPending   = "pending"
+	ReservationCommitted = "committed"
+	ReservationReleased  = "released"
+	ReservationExpired   = "expired"
+)
+
+type Reservation struct {
+	gorm.Model
+	Reference string            `json:"reference"`
+	Status    string            `gorm:"index;not null" json:"status"`
+	ExpiresAt time.Time         `gorm:"index;not null" json:"expires_at"`
+	Items     []ReservationItem `json:"items"`
+}
+
+type ReservationItem struct {
+	ID            uint  `gorm:"primaryKey" json:"id"`
+	ReservationID uint  `gorm:"index;not null" json:"reservation_id"`
+	ProductID     uint  `gorm:"index;not null" json:"product_id"`
+	VariantID     uint  `gorm:"not null;default:0" json:"variant_id"` // 0 for the product's own stock
+	Quantity      int32 `json:"quantity"`
+}
@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+// Reasons recorded on stock movements.
+const (
+	MovementInitial            = "initial"
+	MovementSale               = "sale"
+	MovementReservation        = "reservation"
+	MovementReservationRelease = "reservation_release"
+	MovementReservationExpiry  = "reservation_expiry"
+	MovementCancellation       = "cancellation"
+	MovementReturn             = "return"
+	MovementCorrection         = "correction"
+	MovementAdminEdit          = "admin_edit"
+)
+
+// StockMovement is one row of the append-only inventory ledger. Every change
+// to Product.Stock or Variant.Stock writes exactly one movement in the same
+// transaction.
+type StockMovement struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	ProductID uint      `gorm:"not null;index:idx_stock_movements_product_time,priority:1" json:"product_id"`
+	VariantID uint      `gorm:"not null;default:0" json:"variant_id"` // 0 for the product's own stock
+	Delta     int32     `gorm:"not null" json:"delta"`
+	Balance   int32     `gorm:"not null" json:"balance"` // stock after the movement
+	Reason    string    `gorm:"not null" json:"reason"`
+	Reference string    `json:"reference"` // order or reservation the movement belongs to
+	Caller    string    `json:"caller"`
+	CreatedAt time.Time `gorm:"index:idx_stock_movements_product_time,priority:2" json:"created_at"`
+}
@@ -0,0 +1,26 @@
+package models
+
+import "gorm.io/gorm"
+
+// Variant is one sellable version of a product, e.g. the black 128 GB phone.
+// A product with variants is sold per variant, its own stock is not used.
+type Variant struct {
+	gorm.Model
+	ProductID  uint            `gorm:"index;not null" json:"product_id"`
+	SKU        string          `gorm:"size:64;not null;uniqueIndex:idx_variants_sku,where:deleted_at IS NULL" json:"sku"`
+	PriceMinor int64           `gorm:"not null;default:0" json:"price_minor"` // price in minor units (paise)
+	Currency   string          `gorm:"size:3;not null;default:'INR'" json:"currency"`
+	Stock      int32           `gorm:"not null;default:0" json:"stock"`
+	ImageUrl   string          `json:"image_url"`
+	Options    []VariantOption `json:"options"`
+}
+
+// VariantOption is one option value of a variant, e.g. color: Black.
+// Position keeps the options in the order they were given.
+type VariantOption struct {
+	ID        uint   `gorm:"primaryKey" json:"id"`
+	VariantID uint   `gorm:"index;not null" json:"variant_id"`
+	Position  int32  `gorm:"not null;default:0" json:"position"`
+	Name      string `gorm:"size:50;not null" json:"name"`
+	Value     string `gorm:"size:100;not null" json:"value"`
+}
@@ -0,0 +1,72 @@
+package money
+
+import (
+	"errors"
+	"math"
+	"strings"
+
+	"github.com/Manuelmastro/mobilehub-product/v3/pkg/pb"
+)
+
+const (
+	DefaultCurrency = "INR"
+
+	// Prices are stored in minor units with two decimal places, paise for INR.
+	minorPerUnit  = 100
+	nanosPerMinor = 1_000_000_000 / minorPerUnit
+
+	// MaxUnits bounds the whole units of an amount, beyond it the minor units
+	// overflow an int64. An amount of exactly MaxUnits can have no fraction,
+	// most would overflow too.
+	MaxUnits = math.MaxInt64 / minorPerUnit
+)
+
+var ErrInvalid = errors.New("invalid money amount")
+
+// ToProto converts an amount in minor units to a Money message.
+func ToProto(minor int64, currency string) *pb.Money {
+	return &pb.Money{
+		CurrencyCode: currency,
+		Units:        minor / minorPerUnit,
+		Nanos:        int32(minor%minorPerUnit) * nanosPerMinor,
+	}
+}
+
+// FromProto converts m to minor units and its currency. Amounts finer
+// than one minor unit are rejected rather than rounded.
+func FromProto(m *pb.Money, fallbackCurrency string) (int64, string, error) {
+	if m.Nanos <= -1_000_000_000 || m.Nanos >= 1_000_000_000 || m.Nanos%nanosPerMinor != 0 {
+		return 0, "", ErrInvalid
+	}
+	if (m.Units > 0 && m.Nanos < 0) || (m.Units < 0 && m.Nanos > 0) {
+		return 0, "", ErrInvalid
+	}
+	if m.Units > MaxUnits || m.Units < -MaxUnits ||
+		((m.Units == MaxUnits || m.Units == -MaxUnits) && m.Nanos != 0) {
+		return 0, "", ErrInvalid
+	}
+
+	currency := strings.ToUpper(m.CurrencyCode)
+	if currency == "" {
+		currency = fallbackCurrency
+	}
+	if len(currency) != 3 {
+		return 0, "", ErrInvalid
+	}
+
+	return m.Units*minorPerUnit + int64(m.Nanos/nanosPerMinor), currency, nil
+}
+
+// FromFloat supports clients still sending the deprecated float prices.
+// Amounts that are not numbers or do not fit in minor units are rejected.
+func FromFloat(f float32) (int64, error) {
+	if math.IsNaN(float64(f)) || math.Abs(float64(f)) >= MaxUnits {
+		return 0, ErrInvalid
+	}
+	return int64(math.Round(float64(f) * minorPerUnit)), nil
+}
+
+// ToFloat fills the deprecated float price fields for old clients.
+func ToFloat(minor int64) float32 {
+	return float32(float64(minor) / minorPerUnit)
+}
@@ -0,0 +1,48 @@
+package money
+
+import (
+	"math"
+	"testing"
+
+	"github.com/Manuelmastro/mobilehub-product/v3/pkg/pb"
+)
+
+func TestMoneyRoundTrip(t *testing.T) {
+	for _, minor := range []int64{0, 1, 99, 100, 7999999, -250, MaxUnits * minorPerUnit, -MaxUnits * minorPerUnit} {
+		m := ToProto(minor, "INR")
+		got, currency, err := FromProto(m, "USD")
+		if err != nil {
+			t.Fatalf("%d: %v", minor, err)
+		}
+		if got != minor || currency != "INR" {
+			t.Errorf("%d: round trip gave %d %s", minor, got, currency)
+		}
+	}
+}
+
+func TestMoneyFromProtoRejectsBadAmounts(t *testing.T) {
+	for _, m := range []*pb.Money{
+		{Units: 1, Nanos: 5},                    // finer than a paisa
+		{Units: 1, Nanos: -10_000_000},          // mixed signs
+		{Units: 0, Nanos: 1_000_000_000},        // nanos out of range
+		{Units: 1, CurrencyCode: "RUPEES"},      // not an ISO code
+		{Units: MaxUnits + 1},                   // overflows the minor units
+		{Units: MaxUnits, Nanos: 990_000_000},   // would wrap to a negative price
+		{Units: -MaxUnits, Nanos: -990_000_000}, // would wrap to a positive price
+	} {
+		if _, _, err := FromProto(m, "INR"); err == nil {
+			t.Errorf("%v: expected error", m)
+		}
+	}
+}
+
+func TestFromFloat(t *testing.T) {
+	if got, err := FromFloat(79999.99); err != nil || got != 7999999 {
+		t.Errorf("FromFloat(79999.99) = %d, %v, want 7999999", got, err)
+	}
+	for _, f := range []float32{1e30, -1e30, float32(math.Inf(1)), float32(math.NaN())} {
+		if got, err := FromFloat(f); err == nil {
+			t.Errorf("FromFloat(%g) = %d, want an error", f, got)
+		}
+	}
+}
@@ -0,0 +1,345 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/Manuelmastro/mobilehub-product/v3/pkg/models"
+	"gorm.io/gorm"
+)
+
+// GormProducts is the ProductRepository of the service database.
+type GormProducts struct {
+	db *gorm.DB
+}
+
+var _ ProductRepository = (*GormProducts)(nil)
+
+func NewGormProducts(db *gorm.DB) *GormProducts {
+	return &GormProducts{db: db}
+}
+
+// dbTime is t as the GORM repositories write and compare it. SQLite keeps
+// times as text and compares them as text, which orders the times of a single
+// time zone only, so every time goes in as local time, like the ones GORM
+// stamps itself.
+func dbTime(t time.Time) time.Time {
+	return t.Local()
+}
+
+// Product queries never lean on GORM's implicit soft-delete scope, each one
+// says whether deleted products count. liveProducts is the catalogue,
+// allProducts also covers deleted products, which order history still needs.
+func liveProducts(db *gorm.DB) *gorm.DB {
+	return allProducts(db).Where("deleted_at IS NULL")
+}
+
+func allProducts(db *gorm.DB) *gorm.DB {
+	return db.Model(&models.Product{}).Unscoped()
+}
+
+// Variant queries are explicit about deleted rows, like product queries.
+func liveVariants(db *gorm.DB) *gorm.DB {
+	return allVariants(db).Where("deleted_at IS NULL")
+}
+
+func allVariants(db *gorm.DB) *gorm.DB {
+	return db.Model(&models.Variant{}).Unscoped()
+}
+
+// preloadVariants loads the live variants of the products queried by db,
+// with their options in the order they were given.
+func preloadVariants(db *gorm.DB) *gorm.DB {
+	return db.
+		Preload("Variants", func(db *gorm.DB) *gorm.DB {
+			return db.Unscoped().Where("deleted_at IS NULL").Order("id")
+		}).
+		Preload("Variants.Options", func(db *gorm.DB) *gorm.DB {
+			return db.Order("position")
+		})
+}
+
+func (r *GormProducts) Get(ctx context.Context, id uint, includeDeleted bool) (models.Product, error) {
+	var product models.Product
+	err := preloadVariants(allProducts(r.db.WithContext(ctx))).Preload("Category").Where("id = ?", id).Take(&product).Error
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return models.Product{}, ErrProductNotFound
+	case err != nil:
+		return models.Product{}, err
+	case product.DeletedAt.Valid && !includeDeleted:
+		return models.Product{}, ErrProductDiscontinued
+	}
+	return product, nil
+}
+
+func (r *GormProducts) List(ctx context.Context, q ProductQuery) ([]models.Product, int64, error) {
+	db := r.db.WithContext(ctx)
+
+	base, order := liveProducts(db), productOrder(q.Sort)
+	switch q.Listing {
+	case ListDeleted:
+		base, order = allProducts(db).Where("deleted_at IS NOT NULL"), "deleted_at DESC"
+	case ListFeatured:
+		base, order = base.Where("featured_rank IS NOT NULL"), "featured_rank ASC, created_at DESC"
+	case ListPopular:
+		base, order = base.Where("recent_sales > 0"), "recent_sales DESC"
+	}
+
+	tx, err := r.applyFilter(ctx, base, q.Filter)
+	if err != nil {
+		return nil, 0, err
+	}
+	tx = tx.Session(&gorm.Session{})
+
+	var total int64
+	if err := tx.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var products []models.Product
+	err = preloadVariants(tx).Preload("Category").
+		Order(order).Order("id DESC").
+		Offset(q.Offset).Limit(q.Limit).
+		Find(&products).Error
+	return products, total, err
+}
+
+func (r *GormProducts) applyFilter(ctx context.Context, tx *gorm.DB, f ProductFilter) (*gorm.DB, error) {
+	if f.CategoryName != "" {
+		tx = tx.Where("category_id IN (?)", tx.Session(&gorm.Session{NewDB: true}).
+			Model(&models.Category{}).Select("id").Where("LOWER(name) = LOWER(?)", f.CategoryName))
+	}
+	if f.CategoryID != 0 {
+		parents, err := categoryParents(r.db.WithContext(ctx))
+		if err != nil {
+			return nil, err
+		}
+		tx = tx.Where("category_id IN ?", subtree(parents, f.CategoryID))
+	}
+	if f.MinPriceMinor != nil {
+		tx = tx.Where("price_minor >= ?", *f.MinPriceMinor)
+	}
+	if f.MaxPriceMinor != nil {
+		tx = tx.Where("price_minor <= ?", *f.MaxPriceMinor)
+	}
+	if f.InStockOnly {
+		// Once a product has variants only their stock counts.
+		variants := func() *gorm.DB {
+			return liveVariants(tx.Session(&gorm.Session{NewDB: true})).Select("product_id")
+		}
+		tx = tx.Where("(stock > 0 AND id NOT IN (?)) OR id IN (?)", variants(), variants().Where("stock > 0"))
+	}
+	if f.NameContains != "" {
+		tx = tx.Where("LOWER(product_name) LIKE LOWER(?) ESCAPE '\\'", "%"+escapeLike(f.NameContains)+"%")
+	}
+	return tx, nil
+}
+
+func productOrder(sort Sort) string {
+	switch sort {
+	case SortPriceAsc:
+		return "price_minor ASC"
+	case SortPriceDesc:
+		return "price_minor DESC"
+	case SortNameAsc:
+		return "product_name ASC"
+	case SortNameDesc:
+		return "product_name DESC"
+	default:
+		return "created_at DESC"
+	}
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+func escapeLike(s string) string {
+	return likeEscaper.Replace(s)
+}
+
+func (r *GormProducts) Create(ctx context.Context, product *models.Product, caller string) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(product).Error; err != nil {
+			return err
+		}
+		if product.Stock == 0 {
+			return nil
+		}
+		return recordMovement(tx, StockItem{ProductID: product.ID}, product.Stock, Movement{
+			Reason: models.MovementInitial,
+			Caller: caller,
+		})
+	})
+}
+
+func (r *GormProducts) Update(ctx context.Context, id uint, expectedVersion int64, change ProductChange) (int64, error) {
+	// Only the changed columns are written, so an edit never clobbers fields
+	// it did not mean to change, stock sold in the meantime included. The
+	// version check and bump happen in the same UPDATE, so of two admins
+	// editing from the same version only the first one wins.
+	updates := map[string]any{"version": gorm.Expr("version + 1")}
+	if change.Name != nil {
+		updates["product_name"] = *change.Name
+	}
+	if change.Description != nil {
+		updates["description"] = *change.Description
+	}
+	if change.ImageURL != nil {
+		updates["image_url"] = *change.ImageURL
+	}
+	if change.PriceMinor != nil {
+		updates["price_minor"] = *change.PriceMinor
+		updates["currency"] = change.Currency
+	}
+	if change.CategoryID != nil {
+		updates["category_id"] = *change.CategoryID
+	}
+
+	var version int64
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := liveProducts(tx).
+			Where("id = ? AND version = ?", id, expectedVersion).
+			Updates(updates)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrVersionMismatch
+		}
+		if err := liveProducts(tx).Where("id = ?", id).Pluck("version", &version).Error; err != nil {
+			return err
+		}
+		if change.Stock == nil {
+			return nil
+		}
+		var variants int64
+		if err := liveVariants(tx).Where("product_id = ?", id).Count(&variants).Error; err != nil {
+			return err
+		}
+		if variants > 0 {
+			return ErrVariantRequired
+		}
+		return setStockLevel(tx, StockItem{ProductID: id}, *change.Stock, Movement{
+			Reason: models.MovementAdminEdit,
+			Caller: change.Caller,
+		})
+	})
+	return version, err
+}
+
+func (r *GormProducts) Delete(ctx context.Context, id uint) error {
+	res := liveProducts(r.db.WithContext(ctx)).Where("id = ?", id).Update("deleted_at", time.Now())
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		_, err := r.Get(ctx, id, false)
+		return err
+	}
+	return nil
+}
+
+func (r *GormProducts) Restore(ctx context.Context, id uint) error {
+	res := allProducts(r.db.WithContext(ctx)).
+		Where("id = ? AND deleted_at IS NOT NULL", id).
+		Update("deleted_at", nil)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		if _, err := r.Get(ctx, id, false); err != nil {
+			return err
+		}
+		return ErrProductNotDeleted
+	}
+	return nil
+}
+
+// Purge refuses while pending reservations still hold the product's stock,
+// releasing them later would have nowhere to put the stock back.
+func (r *GormProducts) Purge(ctx context.Context, id uint) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Unscoped().
+			Where("id = ? AND deleted_at IS NOT NULL", id).
+			Delete(&models.Product{})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			var count int64
+			if err := allProducts(tx).Where("id = ?", id).Count(&count).Error; err != nil {
+				return err
+			}
+			if count == 0 {
+				return ErrProductNotFound
+			}
+			return ErrProductNotDeleted
+		}
+
+		var pending int64
+		if err := tx.Model(&models.ReservationItem{}).
+			Where("product_id = ? AND reservation_id IN (?)", id, pendingReservations(tx)).
+			Count(&pending).Error; err != nil {
+			return err
+		}
+		if pending > 0 {
+			return ErrProductInUse
+		}
+
+		variants := allVariants(tx.Session(&gorm.Session{NewDB: true})).Select("id").Where("product_id = ?", id)
+		if err := tx.Where("variant_id IN (?)", variants).Delete(&models.VariantOption{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("product_id = ?", id).Delete(&models.Variant{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("product_id = ?", id).Delete(&models.Offer{}).Error
+	})
+}
+
+func (r *GormProducts) Purgeable(ctx context.Context, deletedBefore time.Time, limit int) ([]uint, error) {
+	db := r.db.WithContext(ctx)
+	held := db.Model(&models.ReservationItem{}).
+		Select("product_id").
+		Where("reservation_id IN (?)", pendingReservations(db))
+
+	var ids []uint
+	err := allProducts(db).
+		Where("deleted_at < ?", dbTime(deletedBefore)).
+		Where("id NOT IN (?)", held).
+		Order("deleted_at").
+		Limit(limit).
+		Pluck("id", &ids).Error
+	return ids, err
+}
+
+// pendingReservations is a subquery of the IDs of reservations that still
+// hold stock.
+func pendingReservations(tx *gorm.DB) *gorm.DB {
+	return tx.Session(&gorm.Session{NewDB: true}).Model(&models.Reservation{}).
+		Select("id").
+		Where("status = ?", models.ReservationPending)
+}
+
+func (r *GormProducts) SetFeaturedRank(ctx context.Context, id uint, rank *int32) error {
+	res := liveProducts(r.db.WithContext(ctx)).Where("id = ?", id).UpdateColumn("featured_rank", rank)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		_, err := r.Get(ctx, id, false)
+		return err
+	}
+	return nil
+}
+
+func (r *GormProducts) RefreshRecentSales(ctx context.Context, since time.Time) error {
+	db := r.db.WithContext(ctx)
+	sales := db.Model(&models.StockMovement{}).
+		Select("COALESCE(SUM(-delta), 0)").
+		Where("stock_movements.product_id = products.id AND reason = ? AND stock_movements.created_at >= ?",
+			models.MovementSale, dbTime(since))
+	return liveProducts(db).UpdateColumn("recent_sales", sales).Error
+}
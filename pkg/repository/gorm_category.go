@@ -0,0 +1,201 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Manuelmastro/mobilehub-product/v3/pkg/models"
+	"github.com/Manuelmastro/mobilehub-product/v3/pkg/slug"
+	"gorm.io/gorm"
+)
+
+// GormCategories is the CategoryRepository of the service database.
+type GormCategories struct {
+	db *gorm.DB
+}
+
+var _ CategoryRepository = (*GormCategories)(nil)
+
+func NewGormCategories(db *gorm.DB) *GormCategories {
+	return &GormCategories{db: db}
+}
+
+func (r *GormCategories) Get(ctx context.Context, id uint) (models.Category, error) {
+	return findCategory(r.db.WithContext(ctx), id)
+}
+
+func findCategory(db *gorm.DB, id uint) (models.Category, error) {
+	var category models.Category
+	err := db.Where("id = ?", id).Take(&category).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return category, ErrCategoryNotFound
+	}
+	return category, err
+}
+
+func (r *GormCategories) Resolve(ctx context.Context, id uint, name string) (models.Category, error) {
+	db := r.db.WithContext(ctx)
+	if id > 0 {
+		db = db.Where("id = ?", id)
+	} else {
+		db = db.Where("LOWER(name) = LOWER(?) OR REPLACE(slug, '-', '') = ?", name, spelling(name)).Order("id")
+	}
+
+	var category models.Category
+	err := db.Take(&category).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return category, ErrCategoryNotFound
+	}
+	return category, err
+}
+
+func (r *GormCategories) List(ctx context.Context) ([]models.Category, error) {
+	var categories []models.Category
+	err := r.db.WithContext(ctx).Order("sort_order").Order("name").Order("id").Find(&categories).Error
+	return categories, err
+}
+
+func (r *GormCategories) Parents(ctx context.Context) (map[uint]uint, error) {
+	return categoryParents(r.db.WithContext(ctx))
+}
+
+// categoryParents maps the ID of every subcategory to its parent's, product
+// listings need it to filter by a whole subtree.
+func categoryParents(db *gorm.DB) (map[uint]uint, error) {
+	var categories []models.Category
+	if err := db.Select("id", "parent_id").Where("parent_id IS NOT NULL").Find(&categories).Error; err != nil {
+		return nil, err
+	}
+
+	parents := make(map[uint]uint, len(categories))
+	for _, c := range categories {
+		parents[c.ID] = *c.ParentID
+	}
+	return parents, nil
+}
+
+func (r *GormCategories) Create(ctx context.Context, category *models.Category) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := checkParent(tx, 0, category.ParentID); err != nil {
+			return err
+		}
+		if err := checkSlug(tx, category.Slug, 0); err != nil {
+			return err
+		}
+		return categoryWriteError(tx.Create(category).Error)
+	})
+}
+
+func (r *GormCategories) Update(ctx context.Context, id uint, change CategoryChange) (models.Category, error) {
+	var category models.Category
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		if category, err = findCategory(tx, id); err != nil {
+			return err
+		}
+
+		updates := map[string]any{}
+		if change.Name != nil {
+			category.Name = *change.Name
+			updates["name"] = category.Name
+		}
+		if change.ParentID != nil {
+			category.ParentID = nil
+			if parentID := *change.ParentID; parentID != 0 {
+				category.ParentID = &parentID
+			}
+			if err := checkParent(tx, category.ID, category.ParentID); err != nil {
+				return err
+			}
+			updates["parent_id"] = category.ParentID
+		}
+		if change.SortOrder != nil {
+			category.SortOrder = *change.SortOrder
+			updates["sort_order"] = category.SortOrder
+		}
+		// The slug goes last, an empty one follows the name set above.
+		if change.Slug != nil {
+			category.Slug = *change.Slug
+			if category.Slug == "" {
+				category.Slug = slug.Make(category.Name)
+			}
+			if category.Slug == "" {
+				return ErrCategorySlugRequired
+			}
+			if err := checkSlug(tx, category.Slug, category.ID); err != nil {
+				return err
+			}
+			updates["slug"] = category.Slug
+		}
+
+		return categoryWriteError(tx.Model(&category).Updates(updates).Error)
+	})
+	return category, err
+}
+
+func (r *GormCategories) Delete(ctx context.Context, id uint) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		category, err := findCategory(tx, id)
+		if err != nil {
+			return err
+		}
+
+		var children, products int64
+		if err := tx.Model(&models.Category{}).Where("parent_id = ?", category.ID).Count(&children).Error; err != nil {
+			return err
+		}
+		if err := allProducts(tx).Where("category_id = ?", category.ID).Count(&products).Error; err != nil {
+			return err
+		}
+		if children > 0 || products > 0 {
+			return ErrCategoryInUse
+		}
+
+		// Its offers have nothing left to discount.
+		if err := tx.Where("category_id = ?", category.ID).Delete(&models.Offer{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&category).Error
+	})
+}
+
+// checkParent makes sure parentID, if any, exists and is not id itself or one
+// of its descendants, which would cut the subtree loose from the tree.
+func checkParent(tx *gorm.DB, id uint, parentID *uint) error {
+	for next := parentID; next != nil; {
+		if *next == id {
+			return ErrInvalidParent
+		}
+		parent, err := findCategory(tx, *next)
+		if errors.Is(err, ErrCategoryNotFound) {
+			return ErrInvalidParent
+		}
+		if err != nil {
+			return err
+		}
+		next = parent.ParentID
+	}
+	return nil
+}
+
+// checkSlug makes sure no other category than id uses s. The unique index
+// backs this up when two calls race, see categoryWriteError.
+func checkSlug(tx *gorm.DB, s string, id uint) error {
+	var count int64
+	if err := tx.Model(&models.Category{}).Where("slug = ? AND id <> ?", s, id).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrCategorySlugTaken
+	}
+	return nil
+}
+
+// categoryWriteError reports the unique slug index tripping as the slug being
+// taken.
+func categoryWriteError(err error) error {
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return ErrCategorySlugTaken
+	}
+	return err
+}
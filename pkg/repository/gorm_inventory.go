@@ -0,0 +1,204 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Manuelmastro/mobilehub-product/v3/pkg/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// GormInventory is the InventoryRepository of the service database. Inside
+// Atomically it runs on the transaction.
+type GormInventory struct {
+	db *gorm.DB
+}
+
+var _ InventoryRepository = (*GormInventory)(nil)
+
+func NewGormInventory(db *gorm.DB) *GormInventory {
+	return &GormInventory{db: db}
+}
+
+func (r *GormInventory) Atomically(ctx context.Context, fn func(tx InventoryRepository) error) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return fn(&GormInventory{db: tx})
+	})
+}
+
+// Reduce decrements stock with a single conditional UPDATE so concurrent
+// callers can never take the stock below zero. The lookup afterwards only runs
+// when nothing was updated, to tell a missing or deleted product from an empty
+// shelf.
+func (r *GormInventory) Reduce(ctx context.Context, item StockItem, quantity int32, m Movement) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := stockRow(tx, item, false).
+			Where("stock >= ?", quantity).
+			Update("stock", gorm.Expr("stock - ?", quantity))
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 1 {
+			return recordMovement(tx, item, -quantity, m)
+		}
+
+		if err := checkProductLive(tx, item.ProductID); err != nil {
+			return err
+		}
+
+		var variants int64
+		var err error
+		if item.VariantID == 0 {
+			err = liveVariants(tx).Where("product_id = ?", item.ProductID).Count(&variants).Error
+		} else {
+			err = stockRow(tx, item, false).Count(&variants).Error
+		}
+		switch {
+		case err != nil:
+			return err
+		case item.VariantID == 0 && variants > 0:
+			return ErrVariantRequired
+		case item.VariantID != 0 && variants == 0:
+			return ErrVariantNotFound
+		}
+		return ErrInsufficientStock
+	})
+}
+
+func (r *GormInventory) Restore(ctx context.Context, item StockItem, quantity int32, m Movement) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := stockRow(tx, item, true).Update("stock", gorm.Expr("stock + ?", quantity))
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return missingStockRow(tx, item)
+		}
+		return recordMovement(tx, item, quantity, m)
+	})
+}
+
+func (r *GormInventory) Movements(ctx context.Context, q MovementQuery) ([]models.StockMovement, error) {
+	tx := r.db.WithContext(ctx).Where("product_id = ?", q.ProductID)
+	if q.VariantID != 0 {
+		tx = tx.Where("variant_id = ?", q.VariantID)
+	}
+	if q.Start != nil {
+		tx = tx.Where("created_at >= ?", dbTime(*q.Start))
+	}
+	if q.End != nil {
+		tx = tx.Where("created_at < ?", dbTime(*q.End))
+	}
+
+	var movements []models.StockMovement
+	err := tx.Order("created_at DESC").Order("id DESC").
+		Offset(q.Offset).Limit(q.Limit).
+		Find(&movements).Error
+	return movements, err
+}
+
+func (r *GormInventory) CreateReservation(ctx context.Context, reservation *models.Reservation) error {
+	return r.db.WithContext(ctx).Create(reservation).Error
+}
+
+func (r *GormInventory) Reservation(ctx context.Context, id uint) (models.Reservation, error) {
+	var reservation models.Reservation
+	err := r.db.WithContext(ctx).First(&reservation, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return reservation, ErrReservationNotFound
+	}
+	return reservation, err
+}
+
+func (r *GormInventory) CommitReservation(ctx context.Context, id uint, now time.Time) error {
+	res := r.db.WithContext(ctx).Model(&models.Reservation{}).
+		Where("id = ? AND status = ? AND expires_at > ?", id, models.ReservationPending, dbTime(now)).
+		Update("status", models.ReservationCommitted)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		if _, err := r.Reservation(ctx, id); err != nil {
+			return err
+		}
+		return ErrReservationState
+	}
+	return nil
+}
+
+// FinishReservation makes the status update conditional, so only one caller
+// can win the transition.
+func (r *GormInventory) FinishReservation(ctx context.Context, id uint, status string) (models.Reservation, error) {
+	var reservation models.Reservation
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&models.Reservation{}).
+			Where("id = ? AND status = ?", id, models.ReservationPending).
+			Update("status", status)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			var count int64
+			if err := tx.Model(&models.Reservation{}).Where("id = ?", id).Count(&count).Error; err != nil {
+				return err
+			}
+			if count == 0 {
+				return ErrReservationNotFound
+			}
+			return ErrReservationState
+		}
+
+		return tx.Preload("Items", func(db *gorm.DB) *gorm.DB {
+			return db.Order("product_id").Order("variant_id")
+		}).First(&reservation, id).Error
+	})
+	return reservation, err
+}
+
+func (r *GormInventory) ExpiredReservations(ctx context.Context, now time.Time, limit int) ([]uint, error) {
+	var ids []uint
+	err := r.db.WithContext(ctx).Model(&models.Reservation{}).
+		Where("status = ? AND expires_at <= ?", models.ReservationPending, dbTime(now)).
+		Order("expires_at").
+		Limit(limit).
+		Pluck("id", &ids).Error
+	return ids, err
+}
+
+func (r *GormInventory) IdempotencyKey(ctx context.Context, method, key string, cutoff time.Time) (models.IdempotencyKey, error) {
+	var record models.IdempotencyKey
+	err := r.db.WithContext(ctx).
+		Where("method = ? AND idempotency_key = ? AND created_at >= ?", method, key, dbTime(cutoff)).
+		Take(&record).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return record, ErrIdempotencyKeyUnknown
+	}
+	return record, err
+}
+
+func (r *GormInventory) SaveIdempotencyKey(ctx context.Context, record models.IdempotencyKey, cutoff time.Time) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// A key past its retention window may still be around until the
+		// cleanup job runs, it no longer counts.
+		if err := tx.Where("method = ? AND idempotency_key = ? AND created_at < ?", record.Method, record.Key, dbTime(cutoff)).
+			Delete(&models.IdempotencyKey{}).Error; err != nil {
+			return err
+		}
+		res := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&record)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrIdempotencyKeyTaken
+		}
+		return nil
+	})
+}
+
+func (r *GormInventory) DeleteIdempotencyKeys(ctx context.Context, cutoff time.Time) error {
+	return r.db.WithContext(ctx).
+		Where("created_at < ?", dbTime(cutoff)).
+		Delete(&models.IdempotencyKey{}).Error
+}
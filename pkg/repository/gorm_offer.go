@@ -0,0 +1,97 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/Manuelmastro/mobilehub-product/v3/pkg/models"
+	"gorm.io/gorm"
+)
+
+// GormOffers is the OfferRepository of the service database.
+type GormOffers struct {
+	db *gorm.DB
+}
+
+var _ OfferRepository = (*GormOffers)(nil)
+
+func NewGormOffers(db *gorm.DB) *GormOffers {
+	return &GormOffers{db: db}
+}
+
+// runningOffers queries the offers running at now.
+func runningOffers(db *gorm.DB, now time.Time) *gorm.DB {
+	now = dbTime(now)
+	return db.Model(&models.Offer{}).Where("starts_at <= ? AND (ends_at IS NULL OR ends_at > ?)", now, now)
+}
+
+func (r *GormOffers) Running(ctx context.Context, now time.Time) ([]models.Offer, error) {
+	var offers []models.Offer
+	err := runningOffers(r.db.WithContext(ctx), now).Order("id").Find(&offers).Error
+	return offers, err
+}
+
+func (r *GormOffers) List(ctx context.Context, q OfferQuery) ([]models.Offer, error) {
+	tx := r.db.WithContext(ctx).Model(&models.Offer{})
+	if q.RunningAt != nil {
+		tx = runningOffers(r.db.WithContext(ctx), *q.RunningAt)
+	}
+	if q.ProductID != 0 {
+		tx = tx.Where("product_id = ?", q.ProductID)
+	}
+	if q.CategoryID != 0 {
+		tx = tx.Where("category_id = ?", q.CategoryID)
+	}
+
+	var offers []models.Offer
+	err := tx.Order("starts_at DESC").Order("id DESC").Offset(q.Offset).Limit(q.Limit).Find(&offers).Error
+	return offers, err
+}
+
+func (r *GormOffers) Create(ctx context.Context, offer *models.Offer) error {
+	offer.StartsAt = dbTime(offer.StartsAt)
+	if offer.EndsAt != nil {
+		ends := dbTime(*offer.EndsAt)
+		offer.EndsAt = &ends
+	}
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if offer.ProductID != nil {
+			if err := checkProductLive(tx, *offer.ProductID); err != nil {
+				return err
+			}
+		} else if offer.CategoryID != nil {
+			if _, err := findCategory(tx, *offer.CategoryID); err != nil {
+				return err
+			}
+		}
+		return tx.Create(offer).Error
+	})
+}
+
+func (r *GormOffers) Delete(ctx context.Context, id uint) error {
+	res := r.db.WithContext(ctx).Where("id = ?", id).Delete(&models.Offer{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrOfferNotFound
+	}
+	return nil
+}
+
+// checkProductLive makes sure offers and variants only go to products for
+// sale.
+func checkProductLive(tx *gorm.DB, productID uint) error {
+	var product models.Product
+	err := allProducts(tx).Select("deleted_at").Where("id = ?", productID).Take(&product).Error
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return ErrProductNotFound
+	case err != nil:
+		return err
+	case product.DeletedAt.Valid:
+		return ErrProductDiscontinued
+	}
+	return nil
+}
@@ -0,0 +1,195 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/Manuelmastro/mobilehub-product/v3/pkg/models"
+	"gorm.io/gorm"
+)
+
+// GormVariants is the VariantRepository of the service database.
+type GormVariants struct {
+	db *gorm.DB
+}
+
+var _ VariantRepository = (*GormVariants)(nil)
+
+func NewGormVariants(db *gorm.DB) *GormVariants {
+	return &GormVariants{db: db}
+}
+
+func (r *GormVariants) Create(ctx context.Context, variant *models.Variant, caller string) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := checkProductLive(tx, variant.ProductID); err != nil {
+			return err
+		}
+		if err := checkSKU(tx, variant.SKU, 0); err != nil {
+			return err
+		}
+		if err := checkVariantOptions(tx, variant.ProductID, 0, variant.Options); err != nil {
+			return err
+		}
+		// The product's own stock goes before its first variant comes, with
+		// variants already there is none left to set.
+		err := setStockLevel(tx, StockItem{ProductID: variant.ProductID}, 0, Movement{
+			Reason: models.MovementAdminEdit,
+			Caller: caller,
+		})
+		if err != nil {
+			return err
+		}
+		if err := variantWriteError(tx.Create(variant).Error); err != nil {
+			return err
+		}
+		if variant.Stock == 0 {
+			return nil
+		}
+		return recordMovement(tx, StockItem{ProductID: variant.ProductID, VariantID: variant.ID}, variant.Stock, Movement{
+			Reason: models.MovementInitial,
+			Caller: caller,
+		})
+	})
+}
+
+func (r *GormVariants) Update(ctx context.Context, id uint, change VariantChange) (models.Variant, error) {
+	var variant models.Variant
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		if variant, err = findVariant(tx, id); err != nil {
+			return err
+		}
+		if err := checkProductLive(tx, variant.ProductID); err != nil {
+			return err
+		}
+
+		updates := map[string]any{}
+		if change.SKU != nil {
+			if err := checkSKU(tx, *change.SKU, variant.ID); err != nil {
+				return err
+			}
+			updates["sku"] = *change.SKU
+		}
+		if change.Options != nil {
+			if err := checkVariantOptions(tx, variant.ProductID, variant.ID, change.Options); err != nil {
+				return err
+			}
+			if err := tx.Where("variant_id = ?", variant.ID).Delete(&models.VariantOption{}).Error; err != nil {
+				return err
+			}
+			options := make([]models.VariantOption, len(change.Options))
+			for i, o := range change.Options {
+				o.VariantID = variant.ID
+				options[i] = o
+			}
+			if err := tx.Create(&options).Error; err != nil {
+				return err
+			}
+		}
+		if change.PriceMinor != nil {
+			updates["price_minor"] = *change.PriceMinor
+			updates["currency"] = change.Currency
+		}
+		if change.ImageURL != nil {
+			updates["image_url"] = *change.ImageURL
+		}
+
+		if len(updates) > 0 {
+			if err := variantWriteError(liveVariants(tx).Where("id = ?", variant.ID).Updates(updates).Error); err != nil {
+				return err
+			}
+		}
+		if change.Stock != nil {
+			err := setStockLevel(tx, StockItem{ProductID: variant.ProductID, VariantID: variant.ID}, *change.Stock, Movement{
+				Reason: models.MovementAdminEdit,
+				Caller: change.Caller,
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		variant, err = findVariant(tx, id)
+		return err
+	})
+	return variant, err
+}
+
+func (r *GormVariants) Delete(ctx context.Context, id uint) error {
+	res := r.db.WithContext(ctx).Where("id = ? AND deleted_at IS NULL", id).Delete(&models.Variant{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrVariantNotFound
+	}
+	return nil
+}
+
+func findVariant(tx *gorm.DB, id uint) (models.Variant, error) {
+	var variant models.Variant
+	err := preloadVariantOptions(liveVariants(tx)).Where("id = ?", id).Take(&variant).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return variant, ErrVariantNotFound
+	}
+	return variant, err
+}
+
+func preloadVariantOptions(db *gorm.DB) *gorm.DB {
+	return db.Preload("Options", func(db *gorm.DB) *gorm.DB {
+		return db.Order("position")
+	})
+}
+
+// checkSKU makes sure no live variant other than id uses sku. The unique
+// index backs this up when two calls race, see variantWriteError.
+func checkSKU(tx *gorm.DB, sku string, id uint) error {
+	var count int64
+	if err := liveVariants(tx).Where("sku = ? AND id <> ?", sku, id).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrSKUTaken
+	}
+	return nil
+}
+
+// checkVariantOptions makes sure no other live variant of the product has
+// the same combination of options, a buyer could not tell them apart.
+func checkVariantOptions(tx *gorm.DB, productID, id uint, options []models.VariantOption) error {
+	var siblings []models.Variant
+	if err := preloadVariantOptions(liveVariants(tx)).
+		Where("product_id = ? AND id <> ?", productID, id).
+		Find(&siblings).Error; err != nil {
+		return err
+	}
+
+	key := optionsKey(options)
+	for _, sibling := range siblings {
+		if optionsKey(sibling.Options) == key {
+			return ErrDuplicateVariant
+		}
+	}
+	return nil
+}
+
+// optionsKey identifies a combination of options regardless of order and case.
+func optionsKey(options []models.VariantOption) string {
+	parts := make([]string, len(options))
+	for i, o := range options {
+		parts[i] = strings.ToLower(o.Name) + "=" + strings.ToLower(o.Value)
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, "\x00")
+}
+
+// variantWriteError reports the unique SKU index tripping as the SKU being
+// taken.
+func variantWriteError(err error) error {
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return ErrSKUTaken
+	}
+	return err
+}
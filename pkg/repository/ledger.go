@@ -0,0 +1,99 @@
+package repository
+
+import (
+	"github.com/Manuelmastro/mobilehub-product/v3/pkg/models"
+	"gorm.io/gorm"
+)
+
+// setStockAttempts bounds how often setStockLevel retries when stock keeps
+// moving underneath it.
+const setStockAttempts = 3
+
+// stockRow selects the row holding the stock of item. Unless includeDeleted,
+// the row, and for a variant its product, must not be deleted. A product must
+// never have live variants: its own stock was written off with the first one.
+func stockRow(tx *gorm.DB, item StockItem, includeDeleted bool) *gorm.DB {
+	if item.VariantID == 0 {
+		products := liveProducts(tx)
+		if includeDeleted {
+			products = allProducts(tx)
+		}
+		return products.
+			Where("id = ?", item.ProductID).
+			Where("NOT EXISTS (?)", liveVariants(tx.Session(&gorm.Session{NewDB: true})).
+				Select("1").Where("variants.product_id = products.id"))
+	}
+
+	if includeDeleted {
+		return allVariants(tx).Where("id = ? AND product_id = ?", item.VariantID, item.ProductID)
+	}
+	return liveVariants(tx).
+		Where("id = ? AND product_id = ?", item.VariantID, item.ProductID).
+		Where("product_id IN (?)", liveProducts(tx.Session(&gorm.Session{NewDB: true})).Select("id"))
+}
+
+// recordMovement appends a ledger row for a stock change that was just made
+// on tx. The balance is read back on the same transaction, which still holds
+// the row lock taken by the update.
+func recordMovement(tx *gorm.DB, item StockItem, delta int32, m Movement) error {
+	var balances []int32
+	if err := stockRow(tx, item, true).Pluck("stock", &balances).Error; err != nil {
+		return err
+	}
+	if len(balances) == 0 {
+		return missingStockRow(tx, item)
+	}
+
+	return tx.Create(&models.StockMovement{
+		ProductID: item.ProductID,
+		VariantID: item.VariantID,
+		Delta:     delta,
+		Balance:   balances[0],
+		Reason:    m.Reason,
+		Reference: m.Reference,
+		Caller:    m.Caller,
+	}).Error
+}
+
+// missingStockRow tells why stockRow, deleted rows included, found nothing
+// for item: the variant or product is gone, or the product has variants and
+// the stock is theirs.
+func missingStockRow(tx *gorm.DB, item StockItem) error {
+	if item.VariantID != 0 {
+		return ErrVariantNotFound
+	}
+	var products int64
+	if err := allProducts(tx).Where("id = ?", item.ProductID).Count(&products).Error; err != nil {
+		return err
+	}
+	if products == 0 {
+		return ErrProductNotFound
+	}
+	return ErrVariantRequired
+}
+
+// setStockLevel overwrites stock with an absolute value, as admins do when
+// they count the shelf. The write is a compare-and-set against the value the
+// ledger delta was computed from, so a sale landing in between is never lost.
+func setStockLevel(tx *gorm.DB, item StockItem, stock int32, m Movement) error {
+	for attempt := 0; attempt < setStockAttempts; attempt++ {
+		var current int32
+		if err := stockRow(tx, item, false).Pluck("stock", &current).Error; err != nil {
+			return err
+		}
+		if current == stock {
+			return nil
+		}
+
+		res := stockRow(tx, item, false).
+			Where("stock = ?", current).
+			Update("stock", stock)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 1 {
+			return recordMovement(tx, item, stock-current, m)
+		}
+	}
+	return ErrConcurrentStockChange
+}
@@ -0,0 +1,487 @@
+package repository
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Manuelmastro/mobilehub-product/v3/pkg/models"
+	"gorm.io/gorm"
+)
+
+// MemoryProducts is a ProductRepository held in memory, for tests of the
+// services that should not need a database. Besides the products created
+// through it, it only knows the categories, offers, ledger movements and
+// reservation holds put in with its Add and Hold methods, or through the
+// repositories its Categories, Offers, Variants and Inventory return.
+type MemoryProducts struct {
+	mu           sync.Mutex
+	lastID       uint
+	products     map[uint]models.Product
+	categories   map[uint]models.Category
+	offers       []models.Offer
+	movements    []models.StockMovement
+	held         map[uint]bool
+	reservations map[uint]models.Reservation
+	idempotency  map[idempotencyID]models.IdempotencyKey
+}
+
+var _ ProductRepository = (*MemoryProducts)(nil)
+
+func NewMemoryProducts() *MemoryProducts {
+	return &MemoryProducts{
+		products:     map[uint]models.Product{},
+		categories:   map[uint]models.Category{},
+		held:         map[uint]bool{},
+		reservations: map[uint]models.Reservation{},
+		idempotency:  map[idempotencyID]models.IdempotencyKey{},
+	}
+}
+
+// nextID hands out IDs, one sequence serves every kind of row.
+func (m *MemoryProducts) nextID() uint {
+	m.lastID++
+	return m.lastID
+}
+
+// AddCategory stores c, with a new ID unless it has one.
+func (m *MemoryProducts) AddCategory(c models.Category) models.Category {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if c.ID == 0 {
+		c.ID = m.nextID()
+	}
+	m.categories[c.ID] = c
+	return c
+}
+
+// AddOffer stores o with a new ID.
+func (m *MemoryProducts) AddOffer(o models.Offer) models.Offer {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	o.ID = m.nextID()
+	m.offers = append(m.offers, o)
+	return o
+}
+
+// AddMovement appends mv to the ledger, such as a sale made elsewhere.
+func (m *MemoryProducts) AddMovement(mv models.StockMovement) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	mv.ID = m.nextID()
+	if mv.CreatedAt.IsZero() {
+		mv.CreatedAt = time.Now()
+	}
+	m.movements = append(m.movements, mv)
+}
+
+// Movements returns the ledger of a product, oldest first.
+func (m *MemoryProducts) Movements(productID uint) []models.StockMovement {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var movements []models.StockMovement
+	for _, mv := range m.movements {
+		if mv.ProductID == productID {
+			movements = append(movements, mv)
+		}
+	}
+	return movements
+}
+
+// Hold marks a product as held by a pending reservation, or no longer held.
+func (m *MemoryProducts) Hold(productID uint, held bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.held[productID] = held
+}
+
+// holds reports whether a pending reservation holds stock of a product,
+// one marked by Hold or one made through Inventory.
+func (m *MemoryProducts) holds(productID uint) bool {
+	if m.held[productID] {
+		return true
+	}
+	for _, r := range m.reservations {
+		if r.Status != models.ReservationPending {
+			continue
+		}
+		for _, item := range r.Items {
+			if item.ProductID == productID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// load returns a copy of a stored product with its category and live
+// variants, like the GORM repository loads it.
+func (m *MemoryProducts) load(p models.Product) models.Product {
+	if p.CategoryID != nil {
+		if c, ok := m.categories[*p.CategoryID]; ok {
+			p.Category = &c
+		}
+	}
+	p.Variants = liveVariantsOf(p)
+	if p.FeaturedRank != nil {
+		rank := *p.FeaturedRank
+		p.FeaturedRank = &rank
+	}
+	return p
+}
+
+func liveVariantsOf(p models.Product) []models.Variant {
+	var variants []models.Variant
+	for _, v := range p.Variants {
+		if !v.DeletedAt.Valid {
+			variants = append(variants, v)
+		}
+	}
+	return variants
+}
+
+// find returns a stored product, or the error Get reports for it.
+func (m *MemoryProducts) find(id uint, includeDeleted bool) (models.Product, error) {
+	p, ok := m.products[id]
+	switch {
+	case !ok:
+		return models.Product{}, ErrProductNotFound
+	case p.DeletedAt.Valid && !includeDeleted:
+		return models.Product{}, ErrProductDiscontinued
+	}
+	return p, nil
+}
+
+func (m *MemoryProducts) Get(ctx context.Context, id uint, includeDeleted bool) (models.Product, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	p, err := m.find(id, includeDeleted)
+	if err != nil {
+		return p, err
+	}
+	return m.load(p), nil
+}
+
+func (m *MemoryProducts) List(ctx context.Context, q ProductQuery) ([]models.Product, int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var products []models.Product
+	for _, p := range m.products {
+		if m.listed(p, q.Listing) && m.matches(p, q.Filter) {
+			products = append(products, m.load(p))
+		}
+	}
+
+	order := listingOrder(q)
+	slices.SortFunc(products, func(a, b models.Product) int {
+		if c := order(a, b); c != 0 {
+			return c
+		}
+		return cmp.Compare(b.ID, a.ID)
+	})
+
+	total := int64(len(products))
+	products = products[min(q.Offset, len(products)):]
+	if q.Limit > 0 && len(products) > q.Limit {
+		products = products[:q.Limit]
+	}
+	return products, total, nil
+}
+
+func (m *MemoryProducts) listed(p models.Product, listing Listing) bool {
+	switch listing {
+	case ListDeleted:
+		return p.DeletedAt.Valid
+	case ListFeatured:
+		return !p.DeletedAt.Valid && p.FeaturedRank != nil
+	case ListPopular:
+		return !p.DeletedAt.Valid && p.RecentSales > 0
+	default:
+		return !p.DeletedAt.Valid
+	}
+}
+
+func (m *MemoryProducts) matches(p models.Product, f ProductFilter) bool {
+	if f.CategoryName != "" {
+		c, ok := m.categories[deref(p.CategoryID)]
+		if !ok || !strings.EqualFold(c.Name, f.CategoryName) {
+			return false
+		}
+	}
+	if f.CategoryID != 0 && (p.CategoryID == nil || !slices.Contains(subtree(m.parents(), f.CategoryID), *p.CategoryID)) {
+		return false
+	}
+	if f.MinPriceMinor != nil && p.PriceMinor < *f.MinPriceMinor {
+		return false
+	}
+	if f.MaxPriceMinor != nil && p.PriceMinor > *f.MaxPriceMinor {
+		return false
+	}
+	if f.InStockOnly && !inStock(p) {
+		return false
+	}
+	if f.NameContains != "" && !strings.Contains(strings.ToLower(p.ProductName), strings.ToLower(f.NameContains)) {
+		return false
+	}
+	return true
+}
+
+// inStock reports whether p can be bought. Once a product has variants only
+// their stock counts.
+func inStock(p models.Product) bool {
+	variants := liveVariantsOf(p)
+	if len(variants) == 0 {
+		return p.Stock > 0
+	}
+	for _, v := range variants {
+		if v.Stock > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func deref(id *uint) uint {
+	if id == nil {
+		return 0
+	}
+	return *id
+}
+
+// listingOrder compares products in the order the GORM repository lists
+// them, ties aside.
+func listingOrder(q ProductQuery) func(a, b models.Product) int {
+	switch q.Listing {
+	case ListDeleted:
+		return func(a, b models.Product) int { return b.DeletedAt.Time.Compare(a.DeletedAt.Time) }
+	case ListFeatured:
+		return func(a, b models.Product) int {
+			if c := cmp.Compare(*a.FeaturedRank, *b.FeaturedRank); c != 0 {
+				return c
+			}
+			return b.CreatedAt.Compare(a.CreatedAt)
+		}
+	case ListPopular:
+		return func(a, b models.Product) int { return cmp.Compare(b.RecentSales, a.RecentSales) }
+	}
+
+	switch q.Sort {
+	case SortPriceAsc:
+		return func(a, b models.Product) int { return cmp.Compare(a.PriceMinor, b.PriceMinor) }
+	case SortPriceDesc:
+		return func(a, b models.Product) int { return cmp.Compare(b.PriceMinor, a.PriceMinor) }
+	case SortNameAsc:
+		return func(a, b models.Product) int { return cmp.Compare(a.ProductName, b.ProductName) }
+	case SortNameDesc:
+		return func(a, b models.Product) int { return cmp.Compare(b.ProductName, a.ProductName) }
+	default:
+		return func(a, b models.Product) int { return b.CreatedAt.Compare(a.CreatedAt) }
+	}
+}
+
+// Create stores product with its variants, all with new IDs.
+func (m *MemoryProducts) Create(ctx context.Context, product *models.Product, caller string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	product.ID = m.nextID()
+	product.CreatedAt, product.UpdatedAt = now, now
+	if product.Version == 0 {
+		product.Version = 1
+	}
+	for i := range product.Variants {
+		v := &product.Variants[i]
+		v.ID, v.ProductID = m.nextID(), product.ID
+		v.CreatedAt, v.UpdatedAt = now, now
+	}
+
+	stored := *product
+	stored.Category = nil
+	stored.Variants = slices.Clone(product.Variants)
+	m.products[product.ID] = stored
+
+	if product.Stock != 0 {
+		m.record(StockItem{ProductID: product.ID}, product.Stock, product.Stock, Movement{
+			Reason: models.MovementInitial,
+			Caller: caller,
+		})
+	}
+	return nil
+}
+
+// record appends the ledger row of a stock change of item that left balance.
+func (m *MemoryProducts) record(item StockItem, delta, balance int32, mv Movement) {
+	m.movements = append(m.movements, models.StockMovement{
+		ID:        m.nextID(),
+		ProductID: item.ProductID,
+		VariantID: item.VariantID,
+		Delta:     delta,
+		Balance:   balance,
+		Reason:    mv.Reason,
+		Reference: mv.Reference,
+		Caller:    mv.Caller,
+		CreatedAt: time.Now(),
+	})
+}
+
+func (m *MemoryProducts) Update(ctx context.Context, id uint, expectedVersion int64, change ProductChange) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	p, err := m.find(id, false)
+	if err != nil || p.Version != expectedVersion {
+		return 0, ErrVersionMismatch
+	}
+	// The whole edit is rejected, as the GORM transaction rolls back.
+	if change.Stock != nil && len(liveVariantsOf(p)) > 0 {
+		return 0, ErrVariantRequired
+	}
+
+	if change.Name != nil {
+		p.ProductName = *change.Name
+	}
+	if change.Description != nil {
+		p.Description = *change.Description
+	}
+	if change.ImageURL != nil {
+		p.ImageUrl = *change.ImageURL
+	}
+	if change.PriceMinor != nil {
+		p.PriceMinor, p.Currency = *change.PriceMinor, change.Currency
+	}
+	if change.CategoryID != nil {
+		categoryID := *change.CategoryID
+		p.CategoryID = &categoryID
+	}
+	if change.Stock != nil && *change.Stock != p.Stock {
+		m.record(StockItem{ProductID: id}, *change.Stock-p.Stock, *change.Stock, Movement{
+			Reason: models.MovementAdminEdit,
+			Caller: change.Caller,
+		})
+		p.Stock = *change.Stock
+	}
+	p.Version++
+	p.UpdatedAt = time.Now()
+	m.products[id] = p
+	return p.Version, nil
+}
+
+func (m *MemoryProducts) Delete(ctx context.Context, id uint) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	p, err := m.find(id, false)
+	if err != nil {
+		return err
+	}
+	p.DeletedAt = gorm.DeletedAt{Time: time.Now(), Valid: true}
+	m.products[id] = p
+	return nil
+}
+
+func (m *MemoryProducts) Restore(ctx context.Context, id uint) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	p, err := m.find(id, true)
+	if err != nil {
+		return err
+	}
+	if !p.DeletedAt.Valid {
+		return ErrProductNotDeleted
+	}
+	p.DeletedAt = gorm.DeletedAt{}
+	m.products[id] = p
+	return nil
+}
+
+func (m *MemoryProducts) Purge(ctx context.Context, id uint) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	p, err := m.find(id, true)
+	switch {
+	case err != nil:
+		return err
+	case !p.DeletedAt.Valid:
+		return ErrProductNotDeleted
+	case m.holds(id):
+		return ErrProductInUse
+	}
+
+	delete(m.products, id)
+	m.offers = slices.DeleteFunc(m.offers, func(o models.Offer) bool {
+		return o.ProductID != nil && *o.ProductID == id
+	})
+	return nil
+}
+
+func (m *MemoryProducts) Purgeable(ctx context.Context, deletedBefore time.Time, limit int) ([]uint, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var deleted []models.Product
+	for _, p := range m.products {
+		if p.DeletedAt.Valid && p.DeletedAt.Time.Before(deletedBefore) && !m.holds(p.ID) {
+			deleted = append(deleted, p)
+		}
+	}
+	slices.SortFunc(deleted, func(a, b models.Product) int { return a.DeletedAt.Time.Compare(b.DeletedAt.Time) })
+
+	var ids []uint
+	for _, p := range deleted[:min(limit, len(deleted))] {
+		ids = append(ids, p.ID)
+	}
+	return ids, nil
+}
+
+func (m *MemoryProducts) SetFeaturedRank(ctx context.Context, id uint, rank *int32) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	p, err := m.find(id, false)
+	if err != nil {
+		return err
+	}
+	p.FeaturedRank = nil
+	if rank != nil {
+		r := *rank
+		p.FeaturedRank = &r
+	}
+	m.products[id] = p
+	return nil
+}
+
+func (m *MemoryProducts) RefreshRecentSales(ctx context.Context, since time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	sales := map[uint]int64{}
+	for _, mv := range m.movements {
+		if mv.Reason == models.MovementSale && !mv.CreatedAt.Before(since) {
+			sales[mv.ProductID] -= int64(mv.Delta)
+		}
+	}
+	for id, p := range m.products {
+		if !p.DeletedAt.Valid {
+			p.RecentSales = sales[id]
+			m.products[id] = p
+		}
+	}
+	return nil
+}
+
+func (m *MemoryProducts) parents() map[uint]uint {
+	parents := map[uint]uint{}
+	for _, c := range m.categories {
+		if c.ParentID != nil {
+			parents[c.ID] = *c.ParentID
+		}
+	}
+	return parents
+}
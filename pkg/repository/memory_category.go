@@ -0,0 +1,185 @@
+package repository
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Manuelmastro/mobilehub-product/v3/pkg/models"
+	"github.com/Manuelmastro/mobilehub-product/v3/pkg/slug"
+)
+
+// MemoryCategories is the CategoryRepository of a MemoryProducts, its
+// products see the categories it stores.
+type MemoryCategories struct {
+	m *MemoryProducts
+}
+
+var _ CategoryRepository = (*MemoryCategories)(nil)
+
+// Categories returns the categories of the catalogue as a repository.
+func (m *MemoryProducts) Categories() *MemoryCategories {
+	return &MemoryCategories{m: m}
+}
+
+func (r *MemoryCategories) Get(ctx context.Context, id uint) (models.Category, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	c, ok := r.m.categories[id]
+	if !ok {
+		return models.Category{}, ErrCategoryNotFound
+	}
+	return c, nil
+}
+
+func (r *MemoryCategories) Resolve(ctx context.Context, id uint, name string) (models.Category, error) {
+	if id > 0 {
+		return r.Get(ctx, id)
+	}
+
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	var found *models.Category
+	for _, c := range r.m.categories {
+		if strings.EqualFold(c.Name, name) || strings.ReplaceAll(c.Slug, "-", "") == spelling(name) {
+			if found == nil || c.ID < found.ID {
+				found = &c
+			}
+		}
+	}
+	if found == nil {
+		return models.Category{}, ErrCategoryNotFound
+	}
+	return *found, nil
+}
+
+func (r *MemoryCategories) List(ctx context.Context) ([]models.Category, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	var categories []models.Category
+	for _, c := range r.m.categories {
+		categories = append(categories, c)
+	}
+	slices.SortFunc(categories, func(a, b models.Category) int {
+		if c := cmp.Compare(a.SortOrder, b.SortOrder); c != 0 {
+			return c
+		}
+		if c := cmp.Compare(a.Name, b.Name); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.ID, b.ID)
+	})
+	return categories, nil
+}
+
+func (r *MemoryCategories) Parents(ctx context.Context) (map[uint]uint, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	return r.m.parents(), nil
+}
+
+func (r *MemoryCategories) Create(ctx context.Context, category *models.Category) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	if err := r.checkParent(0, category.ParentID); err != nil {
+		return err
+	}
+	if err := r.checkSlug(category.Slug, 0); err != nil {
+		return err
+	}
+	now := time.Now()
+	category.ID = r.m.nextID()
+	category.CreatedAt, category.UpdatedAt = now, now
+	r.m.categories[category.ID] = *category
+	return nil
+}
+
+func (r *MemoryCategories) Update(ctx context.Context, id uint, change CategoryChange) (models.Category, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	category, ok := r.m.categories[id]
+	if !ok {
+		return category, ErrCategoryNotFound
+	}
+	if change.Name != nil {
+		category.Name = *change.Name
+	}
+	if change.ParentID != nil {
+		category.ParentID = nil
+		if parentID := *change.ParentID; parentID != 0 {
+			category.ParentID = &parentID
+		}
+		if err := r.checkParent(id, category.ParentID); err != nil {
+			return category, err
+		}
+	}
+	if change.SortOrder != nil {
+		category.SortOrder = *change.SortOrder
+	}
+	if change.Slug != nil {
+		category.Slug = *change.Slug
+		if category.Slug == "" {
+			category.Slug = slug.Make(category.Name)
+		}
+		if category.Slug == "" {
+			return category, ErrCategorySlugRequired
+		}
+		if err := r.checkSlug(category.Slug, id); err != nil {
+			return category, err
+		}
+	}
+	category.UpdatedAt = time.Now()
+	r.m.categories[id] = category
+	return category, nil
+}
+
+func (r *MemoryCategories) Delete(ctx context.Context, id uint) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	if _, ok := r.m.categories[id]; !ok {
+		return ErrCategoryNotFound
+	}
+	for _, c := range r.m.categories {
+		if c.ParentID != nil && *c.ParentID == id {
+			return ErrCategoryInUse
+		}
+	}
+	for _, p := range r.m.products {
+		if p.CategoryID != nil && *p.CategoryID == id {
+			return ErrCategoryInUse
+		}
+	}
+
+	r.m.offers = slices.DeleteFunc(r.m.offers, func(o models.Offer) bool {
+		return o.CategoryID != nil && *o.CategoryID == id
+	})
+	delete(r.m.categories, id)
+	return nil
+}
+
+// checkParent works like the GORM one, the caller holds the lock.
+func (r *MemoryCategories) checkParent(id uint, parentID *uint) error {
+	for next := parentID; next != nil; {
+		parent, ok := r.m.categories[*next]
+		if *next == id || !ok {
+			return ErrInvalidParent
+		}
+		next = parent.ParentID
+	}
+	return nil
+}
+
+func (r *MemoryCategories) checkSlug(s string, id uint) error {
+	for _, c := range r.m.categories {
+		if c.Slug == s && c.ID != id {
+			return ErrCategorySlugTaken
+		}
+	}
+	return nil
+}
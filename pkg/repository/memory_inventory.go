@@ -0,0 +1,283 @@
+package repository
+
+import (
+	"cmp"
+	"context"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/Manuelmastro/mobilehub-product/v3/pkg/models"
+)
+
+// MemoryInventory is the InventoryRepository of a MemoryProducts. Atomically
+// holds the lock of the whole catalogue until fn returns, fn must only use
+// the repository it is given.
+type MemoryInventory struct {
+	m  *MemoryProducts
+	tx bool // inside Atomically, the lock is held already
+}
+
+var _ InventoryRepository = (*MemoryInventory)(nil)
+
+// Inventory returns the stock, reservations and idempotency keys of the
+// catalogue as a repository.
+func (m *MemoryProducts) Inventory() *MemoryInventory {
+	return &MemoryInventory{m: m}
+}
+
+type idempotencyID struct {
+	method, key string
+}
+
+// lock takes the lock of the catalogue unless Atomically took it, and returns
+// its release.
+func (r *MemoryInventory) lock() func() {
+	if r.tx {
+		return func() {}
+	}
+	r.m.mu.Lock()
+	return r.m.mu.Unlock
+}
+
+func (r *MemoryInventory) Atomically(ctx context.Context, fn func(tx InventoryRepository) error) error {
+	defer r.lock()()
+	m := r.m
+
+	// Changes replace stored values rather than edit them, shallow copies
+	// are enough to roll back.
+	products := maps.Clone(m.products)
+	movements := len(m.movements)
+	reservations := maps.Clone(m.reservations)
+	idempotency := maps.Clone(m.idempotency)
+
+	err := fn(&MemoryInventory{m: m, tx: true})
+	if err == nil {
+		err = ctx.Err()
+	}
+	if err != nil {
+		m.products = products
+		m.movements = m.movements[:movements]
+		m.reservations = reservations
+		m.idempotency = idempotency
+	}
+	return err
+}
+
+// stock returns the product holding the stock of item and, for a variant,
+// its index among the product's variants. Unless includeDeleted, the product
+// and the variant must be live.
+func (m *MemoryProducts) stock(item StockItem, includeDeleted bool) (models.Product, int, error) {
+	p, err := m.find(item.ProductID, includeDeleted)
+	if err != nil {
+		if item.VariantID != 0 && includeDeleted {
+			err = ErrVariantNotFound
+		}
+		return p, 0, err
+	}
+	if item.VariantID == 0 {
+		if len(liveVariantsOf(p)) > 0 {
+			return p, 0, ErrVariantRequired
+		}
+		return p, -1, nil
+	}
+	for i, v := range p.Variants {
+		if v.ID == item.VariantID && (includeDeleted || !v.DeletedAt.Valid) {
+			return p, i, nil
+		}
+	}
+	return p, 0, ErrVariantNotFound
+}
+
+// addStock puts delta on the stock of item, found by stock, and records it.
+func (m *MemoryProducts) addStock(p models.Product, i int, item StockItem, delta int32, mv Movement) {
+	var balance int32
+	if i < 0 {
+		p.Stock += delta
+		balance = p.Stock
+		m.products[p.ID] = p
+	} else {
+		v := p.Variants[i]
+		v.Stock += delta
+		balance = v.Stock
+		m.storeVariant(p, i, v)
+	}
+	m.record(item, delta, balance, mv)
+}
+
+func (r *MemoryInventory) Reduce(ctx context.Context, item StockItem, quantity int32, mv Movement) error {
+	defer r.lock()()
+
+	p, i, err := r.m.stock(item, false)
+	if err != nil {
+		return err
+	}
+	stock := p.Stock
+	if i >= 0 {
+		stock = p.Variants[i].Stock
+	}
+	if stock < quantity {
+		return ErrInsufficientStock
+	}
+	r.m.addStock(p, i, item, -quantity, mv)
+	return nil
+}
+
+func (r *MemoryInventory) Restore(ctx context.Context, item StockItem, quantity int32, mv Movement) error {
+	defer r.lock()()
+
+	p, i, err := r.m.stock(item, true)
+	if err != nil {
+		return err
+	}
+	r.m.addStock(p, i, item, quantity, mv)
+	return nil
+}
+
+func (r *MemoryInventory) Movements(ctx context.Context, q MovementQuery) ([]models.StockMovement, error) {
+	defer r.lock()()
+
+	var movements []models.StockMovement
+	for _, mv := range r.m.movements {
+		switch {
+		case mv.ProductID != q.ProductID,
+			q.VariantID != 0 && mv.VariantID != q.VariantID,
+			q.Start != nil && mv.CreatedAt.Before(*q.Start),
+			q.End != nil && !mv.CreatedAt.Before(*q.End):
+			continue
+		}
+		movements = append(movements, mv)
+	}
+	slices.SortFunc(movements, func(a, b models.StockMovement) int {
+		if c := b.CreatedAt.Compare(a.CreatedAt); c != 0 {
+			return c
+		}
+		return cmp.Compare(b.ID, a.ID)
+	})
+
+	movements = movements[min(q.Offset, len(movements)):]
+	if q.Limit > 0 && len(movements) > q.Limit {
+		movements = movements[:q.Limit]
+	}
+	return movements, nil
+}
+
+func (r *MemoryInventory) CreateReservation(ctx context.Context, reservation *models.Reservation) error {
+	defer r.lock()()
+	m := r.m
+
+	now := time.Now()
+	reservation.ID = m.nextID()
+	reservation.CreatedAt, reservation.UpdatedAt = now, now
+	for i := range reservation.Items {
+		item := &reservation.Items[i]
+		item.ID, item.ReservationID = m.nextID(), reservation.ID
+	}
+
+	stored := *reservation
+	stored.Items = slices.Clone(reservation.Items)
+	m.reservations[reservation.ID] = stored
+	return nil
+}
+
+func (r *MemoryInventory) Reservation(ctx context.Context, id uint) (models.Reservation, error) {
+	defer r.lock()()
+
+	reservation, ok := r.m.reservations[id]
+	if !ok {
+		return models.Reservation{}, ErrReservationNotFound
+	}
+	reservation.Items = nil
+	return reservation, nil
+}
+
+func (r *MemoryInventory) CommitReservation(ctx context.Context, id uint, now time.Time) error {
+	defer r.lock()()
+
+	reservation, ok := r.m.reservations[id]
+	switch {
+	case !ok:
+		return ErrReservationNotFound
+	case reservation.Status != models.ReservationPending || !reservation.ExpiresAt.After(now):
+		return ErrReservationState
+	}
+	reservation.Status = models.ReservationCommitted
+	reservation.UpdatedAt = time.Now()
+	r.m.reservations[id] = reservation
+	return nil
+}
+
+func (r *MemoryInventory) FinishReservation(ctx context.Context, id uint, status string) (models.Reservation, error) {
+	defer r.lock()()
+
+	reservation, ok := r.m.reservations[id]
+	switch {
+	case !ok:
+		return models.Reservation{}, ErrReservationNotFound
+	case reservation.Status != models.ReservationPending:
+		return models.Reservation{}, ErrReservationState
+	}
+	reservation.Status = status
+	reservation.UpdatedAt = time.Now()
+	r.m.reservations[id] = reservation
+
+	reservation.Items = slices.Clone(reservation.Items)
+	slices.SortFunc(reservation.Items, func(a, b models.ReservationItem) int {
+		if c := cmp.Compare(a.ProductID, b.ProductID); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.VariantID, b.VariantID)
+	})
+	return reservation, nil
+}
+
+func (r *MemoryInventory) ExpiredReservations(ctx context.Context, now time.Time, limit int) ([]uint, error) {
+	defer r.lock()()
+
+	var expired []models.Reservation
+	for _, reservation := range r.m.reservations {
+		if reservation.Status == models.ReservationPending && !reservation.ExpiresAt.After(now) {
+			expired = append(expired, reservation)
+		}
+	}
+	slices.SortFunc(expired, func(a, b models.Reservation) int { return a.ExpiresAt.Compare(b.ExpiresAt) })
+
+	var ids []uint
+	for _, reservation := range expired[:min(limit, len(expired))] {
+		ids = append(ids, reservation.ID)
+	}
+	return ids, nil
+}
+
+func (r *MemoryInventory) IdempotencyKey(ctx context.Context, method, key string, cutoff time.Time) (models.IdempotencyKey, error) {
+	defer r.lock()()
+
+	record, ok := r.m.idempotency[idempotencyID{method, key}]
+	if !ok || record.CreatedAt.Before(cutoff) {
+		return models.IdempotencyKey{}, ErrIdempotencyKeyUnknown
+	}
+	return record, nil
+}
+
+func (r *MemoryInventory) SaveIdempotencyKey(ctx context.Context, record models.IdempotencyKey, cutoff time.Time) error {
+	defer r.lock()()
+
+	id := idempotencyID{record.Method, record.Key}
+	if stored, ok := r.m.idempotency[id]; ok && !stored.CreatedAt.Before(cutoff) {
+		return ErrIdempotencyKeyTaken
+	}
+	if record.CreatedAt.IsZero() {
+		record.CreatedAt = time.Now()
+	}
+	r.m.idempotency[id] = record
+	return nil
+}
+
+func (r *MemoryInventory) DeleteIdempotencyKeys(ctx context.Context, cutoff time.Time) error {
+	defer r.lock()()
+
+	maps.DeleteFunc(r.m.idempotency, func(_ idempotencyID, record models.IdempotencyKey) bool {
+		return record.CreatedAt.Before(cutoff)
+	})
+	return nil
+}
@@ -0,0 +1,98 @@
+package repository
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"time"
+
+	"github.com/Manuelmastro/mobilehub-product/v3/pkg/models"
+)
+
+// MemoryOffers is the OfferRepository of a MemoryProducts.
+type MemoryOffers struct {
+	m *MemoryProducts
+}
+
+var _ OfferRepository = (*MemoryOffers)(nil)
+
+// Offers returns the offers of the catalogue as a repository.
+func (m *MemoryProducts) Offers() *MemoryOffers {
+	return &MemoryOffers{m: m}
+}
+
+func running(o models.Offer, now time.Time) bool {
+	return !o.StartsAt.After(now) && (o.EndsAt == nil || o.EndsAt.After(now))
+}
+
+func (r *MemoryOffers) Running(ctx context.Context, now time.Time) ([]models.Offer, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	var offers []models.Offer
+	for _, o := range r.m.offers {
+		if running(o, now) {
+			offers = append(offers, o)
+		}
+	}
+	return offers, nil
+}
+
+func (r *MemoryOffers) List(ctx context.Context, q OfferQuery) ([]models.Offer, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	var offers []models.Offer
+	for _, o := range r.m.offers {
+		switch {
+		case q.RunningAt != nil && !running(o, *q.RunningAt):
+		case q.ProductID != 0 && deref(o.ProductID) != q.ProductID:
+		case q.CategoryID != 0 && deref(o.CategoryID) != q.CategoryID:
+		default:
+			offers = append(offers, o)
+		}
+	}
+	slices.SortFunc(offers, func(a, b models.Offer) int {
+		if c := b.StartsAt.Compare(a.StartsAt); c != 0 {
+			return c
+		}
+		return cmp.Compare(b.ID, a.ID)
+	})
+
+	offers = offers[min(q.Offset, len(offers)):]
+	if q.Limit > 0 && len(offers) > q.Limit {
+		offers = offers[:q.Limit]
+	}
+	return offers, nil
+}
+
+func (r *MemoryOffers) Create(ctx context.Context, offer *models.Offer) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	switch {
+	case offer.ProductID != nil:
+		if _, err := r.m.find(*offer.ProductID, false); err != nil {
+			return err
+		}
+	case offer.CategoryID != nil:
+		if _, ok := r.m.categories[*offer.CategoryID]; !ok {
+			return ErrCategoryNotFound
+		}
+	}
+	offer.ID = r.m.nextID()
+	r.m.offers = append(r.m.offers, *offer)
+	return nil
+}
+
+func (r *MemoryOffers) Delete(ctx context.Context, id uint) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	n := len(r.m.offers)
+	r.m.offers = slices.DeleteFunc(r.m.offers, func(o models.Offer) bool { return o.ID == id })
+	if len(r.m.offers) == n {
+		return ErrOfferNotFound
+	}
+	return nil
+}
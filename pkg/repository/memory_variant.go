@@ -0,0 +1,176 @@
+package repository
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"time"
+
+	"github.com/Manuelmastro/mobilehub-product/v3/pkg/models"
+	"gorm.io/gorm"
+)
+
+// MemoryVariants is the VariantRepository of a MemoryProducts.
+type MemoryVariants struct {
+	m *MemoryProducts
+}
+
+var _ VariantRepository = (*MemoryVariants)(nil)
+
+// Variants returns the variants of the catalogue as a repository.
+func (m *MemoryProducts) Variants() *MemoryVariants {
+	return &MemoryVariants{m: m}
+}
+
+// findVariant returns the product holding a live variant and the variant's
+// index among its variants.
+func (m *MemoryProducts) findVariant(id uint) (models.Product, int, error) {
+	for _, p := range m.products {
+		for i, v := range p.Variants {
+			if v.ID == id && !v.DeletedAt.Valid {
+				return p, i, nil
+			}
+		}
+	}
+	return models.Product{}, 0, ErrVariantNotFound
+}
+
+// storeVariant replaces the i-th variant of p and stores p. The variants are
+// copied first, a snapshot taken by Atomically may share them.
+func (m *MemoryProducts) storeVariant(p models.Product, i int, v models.Variant) {
+	p.Variants = slices.Clone(p.Variants)
+	p.Variants[i] = v
+	m.products[p.ID] = p
+}
+
+// checkVariant makes sure no live variant other than id uses sku, and no
+// live sibling of it has the same options.
+func (m *MemoryProducts) checkVariant(productID, id uint, sku *string, options []models.VariantOption) error {
+	for _, p := range m.products {
+		for _, v := range liveVariantsOf(p) {
+			if v.ID == id {
+				continue
+			}
+			if sku != nil && v.SKU == *sku {
+				return ErrSKUTaken
+			}
+			if options != nil && p.ID == productID && optionsKey(v.Options) == optionsKey(options) {
+				return ErrDuplicateVariant
+			}
+		}
+	}
+	return nil
+}
+
+// newOptions returns options with new IDs, belonging to variantID.
+func (m *MemoryProducts) newOptions(variantID uint, options []models.VariantOption) []models.VariantOption {
+	options = slices.Clone(options)
+	for i := range options {
+		options[i].ID, options[i].VariantID = m.nextID(), variantID
+	}
+	return options
+}
+
+func (r *MemoryVariants) Create(ctx context.Context, variant *models.Variant, caller string) error {
+	m := r.m
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	p, err := m.find(variant.ProductID, false)
+	if err != nil {
+		return err
+	}
+	if err := m.checkVariant(p.ID, 0, &variant.SKU, variant.Options); err != nil {
+		return err
+	}
+	// The product's own stock goes before its first variant comes.
+	if len(liveVariantsOf(p)) == 0 && p.Stock != 0 {
+		m.record(StockItem{ProductID: p.ID}, -p.Stock, 0, Movement{
+			Reason: models.MovementAdminEdit,
+			Caller: caller,
+		})
+		p.Stock = 0
+	}
+
+	now := time.Now()
+	variant.ID = m.nextID()
+	variant.CreatedAt, variant.UpdatedAt = now, now
+	variant.Options = m.newOptions(variant.ID, variant.Options)
+
+	stored := *variant
+	stored.Options = slices.Clone(variant.Options)
+	p.Variants = append(slices.Clone(p.Variants), stored)
+	m.products[p.ID] = p
+
+	if variant.Stock != 0 {
+		m.record(StockItem{ProductID: p.ID, VariantID: variant.ID}, variant.Stock, variant.Stock, Movement{
+			Reason: models.MovementInitial,
+			Caller: caller,
+		})
+	}
+	return nil
+}
+
+func (r *MemoryVariants) Update(ctx context.Context, id uint, change VariantChange) (models.Variant, error) {
+	m := r.m
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	p, i, err := m.findVariant(id)
+	if err != nil {
+		return models.Variant{}, err
+	}
+	v := p.Variants[i]
+	if p.DeletedAt.Valid {
+		return byPosition(v), ErrProductDiscontinued
+	}
+	if err := m.checkVariant(p.ID, v.ID, change.SKU, change.Options); err != nil {
+		return byPosition(v), err
+	}
+
+	if change.SKU != nil {
+		v.SKU = *change.SKU
+	}
+	if change.Options != nil {
+		v.Options = m.newOptions(v.ID, change.Options)
+	}
+	if change.PriceMinor != nil {
+		v.PriceMinor, v.Currency = *change.PriceMinor, change.Currency
+	}
+	if change.ImageURL != nil {
+		v.ImageUrl = *change.ImageURL
+	}
+	if change.Stock != nil && *change.Stock != v.Stock {
+		m.record(StockItem{ProductID: p.ID, VariantID: v.ID}, *change.Stock-v.Stock, *change.Stock, Movement{
+			Reason: models.MovementAdminEdit,
+			Caller: change.Caller,
+		})
+		v.Stock = *change.Stock
+	}
+	v.UpdatedAt = time.Now()
+	m.storeVariant(p, i, v)
+	return byPosition(v), nil
+}
+
+func (r *MemoryVariants) Delete(ctx context.Context, id uint) error {
+	m := r.m
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	p, i, err := m.findVariant(id)
+	if err != nil {
+		return err
+	}
+	v := p.Variants[i]
+	v.DeletedAt = gorm.DeletedAt{Time: time.Now(), Valid: true}
+	m.storeVariant(p, i, v)
+	return nil
+}
+
+// byPosition returns v with its options in the order they were given, as the
+// GORM repository loads them.
+func byPosition(v models.Variant) models.Variant {
+	v.Options = slices.Clone(v.Options)
+	slices.SortStableFunc(v.Options, func(a, b models.VariantOption) int { return cmp.Compare(a.Position, b.Position) })
+	return v
+}
@@ -0,0 +1,359 @@
+// Package repository keeps the storage of the product catalogue and its
+// inventory behind interfaces, so the services run against Postgres through
+// GORM and their tests, where they can, against memory.
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Manuelmastro/mobilehub-product/v3/pkg/models"
+	"github.com/Manuelmastro/mobilehub-product/v3/pkg/slug"
+)
+
+var (
+	ErrProductNotFound       = errors.New("product not found")
+	ErrProductNotDeleted     = errors.New("product is not deleted")
+	ErrProductInUse          = errors.New("pending reservations hold stock of the product")
+	ErrVersionMismatch       = errors.New("product version mismatch")
+	ErrVariantRequired       = errors.New("product has variants, stock is per variant")
+	ErrVariantNotFound       = errors.New("variant not found")
+	ErrSKUTaken              = errors.New("sku is taken")
+	ErrDuplicateVariant      = errors.New("another variant has the same options")
+	ErrInsufficientStock     = errors.New("insufficient stock")
+	ErrConcurrentStockChange = errors.New("stock changed concurrently")
+	ErrCategoryNotFound      = errors.New("category not found")
+	ErrCategoryInUse         = errors.New("category is still in use")
+	ErrCategorySlugTaken     = errors.New("category slug is taken")
+	ErrCategorySlugRequired  = errors.New("category slug is required when the name has no letters or digits")
+	ErrInvalidParent         = errors.New("invalid parent category")
+	ErrOfferNotFound         = errors.New("offer not found")
+	ErrReservationNotFound   = errors.New("reservation not found")
+	ErrReservationState      = errors.New("reservation is not pending")
+	ErrIdempotencyKeyUnknown = errors.New("idempotency key not recorded")
+	ErrIdempotencyKeyTaken   = errors.New("idempotency key recorded concurrently")
+
+	// ErrProductDiscontinued is the not found error of a deleted product.
+	ErrProductDiscontinued = fmt.Errorf("%w, it is discontinued", ErrProductNotFound)
+)
+
+// ProductRepository stores the product catalogue. Products come back with
+// their category and live variants. Unknown products are reported as
+// ErrProductNotFound and deleted ones, where only live products will do, as
+// ErrProductDiscontinued.
+type ProductRepository interface {
+	// Get loads a product, a deleted one only with includeDeleted.
+	Get(ctx context.Context, id uint, includeDeleted bool) (models.Product, error)
+
+	// List returns the page of products q asks for, and how many products
+	// match q over all pages.
+	List(ctx context.Context, q ProductQuery) ([]models.Product, int64, error)
+
+	// Create adds a product and records its initial stock in the inventory
+	// ledger on behalf of caller.
+	Create(ctx context.Context, product *models.Product, caller string) error
+
+	// Update applies change to a live product still at expectedVersion and
+	// returns the version it is at afterwards. A product that is gone or at
+	// another version is ErrVersionMismatch.
+	Update(ctx context.Context, id uint, expectedVersion int64, change ProductChange) (int64, error)
+
+	// Delete soft-deletes a live product.
+	Delete(ctx context.Context, id uint) error
+
+	// Restore undeletes a soft-deleted product, live products are
+	// ErrProductNotDeleted.
+	Restore(ctx context.Context, id uint) error
+
+	// Purge removes a soft-deleted product for good, with its variants and
+	// offers. It is ErrProductInUse while pending reservations hold its
+	// stock. The inventory ledger is kept.
+	Purge(ctx context.Context, id uint) error
+
+	// Purgeable returns up to limit products deleted before deletedBefore
+	// that no pending reservation holds, longest deleted first.
+	Purgeable(ctx context.Context, deletedBefore time.Time, limit int) ([]uint, error)
+
+	// SetFeaturedRank puts a live product on the featured list at rank, or
+	// takes it off for a nil rank. The product's version is left alone.
+	SetFeaturedRank(ctx context.Context, id uint, rank *int32) error
+
+	// RefreshRecentSales sets the recent sales of every live product to the
+	// units the inventory ledger recorded as sold since.
+	RefreshRecentSales(ctx context.Context, since time.Time) error
+}
+
+// CategoryRepository stores the category tree. Unknown categories are
+// reported as ErrCategoryNotFound.
+type CategoryRepository interface {
+	// Get loads a category.
+	Get(ctx context.Context, id uint) (models.Category, error)
+
+	// Resolve finds a category by ID or, for ID 0, by name. Names match
+	// case-insensitively or through their slug without dashes, the way
+	// migration 0004 merged spellings, so "Smart Phones" finds "Smartphones".
+	Resolve(ctx context.Context, id uint, name string) (models.Category, error)
+
+	// List returns every category by sort order, name and ID. The tree is
+	// small enough to walk in memory.
+	List(ctx context.Context) ([]models.Category, error)
+
+	// Parents maps the ID of every subcategory to its parent's.
+	Parents(ctx context.Context) (map[uint]uint, error)
+
+	// Create adds a category. Its parent has to exist and its slug to be
+	// free, ErrInvalidParent and ErrCategorySlugTaken otherwise.
+	Create(ctx context.Context, category *models.Category) error
+
+	// Update applies change to a category and returns it. A parent that is
+	// missing or inside the category's own subtree is ErrInvalidParent, a
+	// slug another category has ErrCategorySlugTaken.
+	Update(ctx context.Context, id uint, change CategoryChange) (models.Category, error)
+
+	// Delete removes a category along with its offers. A category that still
+	// has subcategories or products, deleted ones included, is
+	// ErrCategoryInUse.
+	Delete(ctx context.Context, id uint) error
+}
+
+// CategoryChange is an edit of a category, nil fields are left as they are.
+type CategoryChange struct {
+	Name *string
+
+	// Slug is made from the name when empty, the new name if it changes too.
+	// A name without letters or digits makes no slug, that is
+	// ErrCategorySlugRequired.
+	Slug *string
+
+	ParentID  *uint // 0 makes the category a root
+	SortOrder *int32
+}
+
+// OfferRepository stores offers. They discount a product or every product
+// below a category.
+type OfferRepository interface {
+	// Running returns the offers running at now, oldest first.
+	Running(ctx context.Context, now time.Time) ([]models.Offer, error)
+
+	// List returns the page of offers q asks for, latest start first.
+	List(ctx context.Context, q OfferQuery) ([]models.Offer, error)
+
+	// Create adds an offer for a live product or an existing category.
+	// Product errors are the ProductRepository's, an unknown category is
+	// ErrCategoryNotFound.
+	Create(ctx context.Context, offer *models.Offer) error
+
+	// Delete removes an offer, whether or not it started.
+	Delete(ctx context.Context, id uint) error
+}
+
+// OfferQuery selects a page of offers, zero fields do not filter.
+type OfferQuery struct {
+	RunningAt  *time.Time // only the offers running then
+	ProductID  uint
+	CategoryID uint
+
+	Offset int
+	Limit  int
+}
+
+// VariantRepository stores the variants of products, with their options.
+// Only live variants of live products change, unknown or deleted variants are
+// ErrVariantNotFound. SKUs and combinations of options are unique among live
+// variants, ErrSKUTaken and ErrDuplicateVariant tell when they are not.
+type VariantRepository interface {
+	// Create adds a variant to a live product and records its initial stock
+	// in the inventory ledger on behalf of caller. From its first variant on
+	// a product is sold per variant, the stock the product held itself is
+	// written off then.
+	Create(ctx context.Context, variant *models.Variant, caller string) error
+
+	// Update applies change to a variant and returns it. The variant comes
+	// back as far as it was loaded with an error too, so errors about its
+	// product can name the product.
+	Update(ctx context.Context, id uint, change VariantChange) (models.Variant, error)
+
+	// Delete soft-deletes a variant. Its ledger stays, a reservation released
+	// later still puts stock back on it.
+	Delete(ctx context.Context, id uint) error
+}
+
+// VariantChange is an edit of a variant, nil fields are left as they are.
+type VariantChange struct {
+	SKU        *string
+	Options    []models.VariantOption // replace the options unless nil
+	PriceMinor *int64
+	Currency   string // set together with PriceMinor
+	ImageURL   *string
+
+	// Stock overwrites the stock level of the variant. The change is recorded
+	// in the inventory ledger as an admin edit by Caller.
+	Stock  *int32
+	Caller string
+}
+
+// InventoryRepository keeps the stock of products and variants, the ledger
+// of every change to it, the reservations holding stock and the idempotency
+// keys of the calls changing it. Changes that belong together go through
+// Atomically.
+type InventoryRepository interface {
+	// Atomically runs fn with the repository bound to a single transaction.
+	// What fn changes commits when it returns nil and rolls back otherwise,
+	// or when ctx is done first.
+	Atomically(ctx context.Context, fn func(tx InventoryRepository) error) error
+
+	// Reduce takes quantity off the stock of item, never below zero, which is
+	// ErrInsufficientStock. Deleted products and variants never lose stock,
+	// nor do products with variants, which is ErrVariantRequired.
+	Reduce(ctx context.Context, item StockItem, quantity int32, m Movement) error
+
+	// Restore puts quantity back on item, deleted or not: stock held for a
+	// product deleted since still belongs to it. A product with variants has
+	// no stock of its own to put back, that is ErrVariantRequired.
+	Restore(ctx context.Context, item StockItem, quantity int32, m Movement) error
+
+	// Movements returns the page of ledger movements q asks for, newest
+	// first.
+	Movements(ctx context.Context, q MovementQuery) ([]models.StockMovement, error)
+
+	// CreateReservation stores a pending reservation with its items. Taking
+	// their stock is up to the caller.
+	CreateReservation(ctx context.Context, reservation *models.Reservation) error
+
+	// Reservation loads a reservation, without its items. Unknown ones are
+	// ErrReservationNotFound.
+	Reservation(ctx context.Context, id uint) (models.Reservation, error)
+
+	// CommitReservation commits a reservation that is pending and has not
+	// expired at now, any other is ErrReservationState.
+	CommitReservation(ctx context.Context, id uint, now time.Time) error
+
+	// FinishReservation moves a pending reservation to status and returns it
+	// with its items in product and variant order. Only one caller moves it,
+	// the others get ErrReservationState. Putting the stock back is up to the
+	// caller.
+	FinishReservation(ctx context.Context, id uint, status string) (models.Reservation, error)
+
+	// ExpiredReservations returns up to limit pending reservations expired at
+	// now, the longest expired first.
+	ExpiredReservations(ctx context.Context, now time.Time, limit int) ([]uint, error)
+
+	// IdempotencyKey loads the record of key for method made since cutoff,
+	// ErrIdempotencyKeyUnknown without one.
+	IdempotencyKey(ctx context.Context, method, key string, cutoff time.Time) (models.IdempotencyKey, error)
+
+	// SaveIdempotencyKey stores record. A record of its key made before
+	// cutoff no longer counts and is replaced, a later one is
+	// ErrIdempotencyKeyTaken.
+	SaveIdempotencyKey(ctx context.Context, record models.IdempotencyKey, cutoff time.Time) error
+
+	// DeleteIdempotencyKeys removes the records made before cutoff.
+	DeleteIdempotencyKeys(ctx context.Context, cutoff time.Time) error
+}
+
+// Movement describes why stock changes, it is written to the inventory ledger
+// together with the change itself.
+type Movement struct {
+	Reason    string
+	Reference string
+	Caller    string
+}
+
+// StockItem names where stock is held: a product, or one of its variants.
+type StockItem struct {
+	ProductID uint
+	VariantID uint // 0 for the product's own stock
+}
+
+// MovementQuery selects a page of the ledger of a product.
+type MovementQuery struct {
+	ProductID uint
+	VariantID uint       // that variant only, 0 for every movement of the product
+	Start     *time.Time // from then on
+	End       *time.Time // before then
+
+	Offset int
+	Limit  int
+}
+
+// Listing picks the products a ProductQuery lists and their order.
+type Listing int
+
+const (
+	ListCatalogue Listing = iota // live products in the requested sort
+	ListDeleted                  // soft-deleted products, most recently deleted first
+	ListFeatured                 // featured live products by rank
+	ListPopular                  // live products that sold recently, best sellers first
+)
+
+// Sort orders the catalogue listing.
+type Sort int
+
+const (
+	SortNewest Sort = iota
+	SortPriceAsc
+	SortPriceDesc
+	SortNameAsc
+	SortNameDesc
+)
+
+// ProductQuery selects a page of products. Ties are broken by ID, newest
+// first, so pages never overlap.
+type ProductQuery struct {
+	Listing Listing
+	Filter  ProductFilter
+	Sort    Sort // only used by ListCatalogue
+
+	Offset int
+	Limit  int
+}
+
+// ProductFilter narrows a listing, zero fields do not filter.
+type ProductFilter struct {
+	CategoryName  string // that category only, matched case-insensitively
+	CategoryID    uint   // the category and all its subcategories
+	MinPriceMinor *int64
+	MaxPriceMinor *int64
+	InStockOnly   bool // products with variants have stock when any variant has
+	NameContains  string
+}
+
+// ProductChange is an edit of a product, nil fields are left as they are.
+type ProductChange struct {
+	Name        *string
+	Description *string
+	ImageURL    *string
+	PriceMinor  *int64
+	Currency    string // set together with PriceMinor
+	CategoryID  *uint
+
+	// Stock overwrites the stock level of a product without variants. The
+	// change is recorded in the inventory ledger as an admin edit by Caller.
+	Stock  *int32
+	Caller string
+}
+
+// subtree returns id and the IDs of all its descendants, in ID order.
+func subtree(parents map[uint]uint, id uint) []uint {
+	children := map[uint][]uint{}
+	for child, parent := range parents {
+		children[parent] = append(children[parent], child)
+	}
+
+	ids := []uint{id}
+	for i := 0; i < len(ids); i++ {
+		ids = append(ids, children[ids[i]]...)
+	}
+	sort.Slice(ids, func(a, b int) bool { return ids[a] < ids[b] })
+	return ids
+}
+
+// spelling is the slug of a category name without its dashes. Names that
+// differ only in case, spacing, accents or punctuation share it.
+func spelling(name string) string {
+	return strings.ReplaceAll(slug.Make(name), "-", "")
+}
@@ -0,0 +1,415 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Manuelmastro/mobilehub-product/v3/pkg/db"
+	"github.com/Manuelmastro/mobilehub-product/v3/pkg/models"
+)
+
+// backend is one implementation of the repositories, every contract test runs
+// against each of them.
+type backend struct {
+	products  ProductRepository
+	variants  VariantRepository
+	inventory InventoryRepository
+}
+
+// gormBackend stores into a SQLite file of the test's own. The tests count
+// rows, a shared database would not do.
+func gormBackend(t *testing.T) backend {
+	t.Helper()
+	h, err := db.Connect("sqlite://"+filepath.Join(t.TempDir(), "product.db"), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := h.DB.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return backend{
+		products:  NewGormProducts(h.DB),
+		variants:  NewGormVariants(h.DB),
+		inventory: NewGormInventory(h.DB),
+	}
+}
+
+func memoryBackend(t *testing.T) backend {
+	m := NewMemoryProducts()
+	return backend{products: m, variants: m.Variants(), inventory: m.Inventory()}
+}
+
+func forEachBackend(t *testing.T, test func(t *testing.T, b backend)) {
+	for _, tc := range []struct {
+		name string
+		new  func(t *testing.T) backend
+	}{
+		{"gorm", gormBackend},
+		{"memory", memoryBackend},
+	} {
+		t.Run(tc.name, func(t *testing.T) { test(t, tc.new(t)) })
+	}
+}
+
+func createProduct(t *testing.T, b backend, name string, priceMinor int64, stock int32) models.Product {
+	t.Helper()
+	product := models.Product{ProductName: name, PriceMinor: priceMinor, Currency: "INR", Stock: stock}
+	if err := b.products.Create(context.Background(), &product, "test"); err != nil {
+		t.Fatal(err)
+	}
+	return product
+}
+
+func checkErr(t *testing.T, what string, err, want error) {
+	t.Helper()
+	if !errors.Is(err, want) {
+		t.Errorf("%s: got %v, want %v", what, err, want)
+	}
+}
+
+func TestProductLifecycle(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b backend) {
+		ctx := context.Background()
+		product := createProduct(t, b, "Pixel 8", 6999900, 5)
+
+		got, err := b.products.Get(ctx, product.ID, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.ProductName != "Pixel 8" || got.Stock != 5 || got.Version != 1 {
+			t.Errorf("created: name %q stock %d version %d", got.ProductName, got.Stock, got.Version)
+		}
+
+		name := "Pixel 8 Pro"
+		_, err = b.products.Update(ctx, product.ID, 2, ProductChange{Name: &name})
+		checkErr(t, "update at a stale version", err, ErrVersionMismatch)
+		version, err := b.products.Update(ctx, product.ID, 1, ProductChange{Name: &name})
+		if err != nil || version != 2 {
+			t.Fatalf("update: version %d, %v", version, err)
+		}
+
+		if err := b.products.Delete(ctx, product.ID); err != nil {
+			t.Fatal(err)
+		}
+		_, err = b.products.Get(ctx, product.ID, false)
+		checkErr(t, "get deleted", err, ErrProductDiscontinued)
+		if got, err := b.products.Get(ctx, product.ID, true); err != nil || got.ProductName != name {
+			t.Errorf("get deleted with includeDeleted: %q, %v", got.ProductName, err)
+		}
+		_, err = b.products.Update(ctx, product.ID, 2, ProductChange{Name: &name})
+		checkErr(t, "update deleted", err, ErrVersionMismatch)
+
+		if err := b.products.Restore(ctx, product.ID); err != nil {
+			t.Fatal(err)
+		}
+		checkErr(t, "restore live", b.products.Restore(ctx, product.ID), ErrProductNotDeleted)
+		checkErr(t, "purge live", b.products.Purge(ctx, product.ID), ErrProductNotDeleted)
+
+		if err := b.products.Delete(ctx, product.ID); err != nil {
+			t.Fatal(err)
+		}
+		if err := b.products.Purge(ctx, product.ID); err != nil {
+			t.Fatal(err)
+		}
+		_, err = b.products.Get(ctx, product.ID, true)
+		checkErr(t, "get purged", err, ErrProductNotFound)
+		checkErr(t, "purge purged", b.products.Purge(ctx, product.ID), ErrProductNotFound)
+		checkErr(t, "delete unknown", b.products.Delete(ctx, product.ID), ErrProductNotFound)
+	})
+}
+
+func TestProductListings(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b backend) {
+		ctx := context.Background()
+		pixel := createProduct(t, b, "Pixel 8", 6999900, 5)
+		galaxy := createProduct(t, b, "Galaxy S24", 7999900, 0)
+		iphone := createProduct(t, b, "iPhone 15", 7999900, 3)
+		nokia := createProduct(t, b, "Nokia 105", 149900, 10)
+
+		list := func(q ProductQuery) ([]uint, int64) {
+			t.Helper()
+			if q.Limit == 0 {
+				q.Limit = 10
+			}
+			products, total, err := b.products.List(ctx, q)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var ids []uint
+			for _, p := range products {
+				ids = append(ids, p.ID)
+			}
+			return ids, total
+		}
+		check := func(what string, q ProductQuery, want []uint, wantTotal int64) {
+			t.Helper()
+			if ids, total := list(q); !slices.Equal(ids, want) || total != wantTotal {
+				t.Errorf("%s: got %v of %d, want %v of %d", what, ids, total, want, wantTotal)
+			}
+		}
+
+		// Equal prices fall back to the newest first.
+		check("by price", ProductQuery{Sort: SortPriceDesc}, []uint{iphone.ID, galaxy.ID, pixel.ID, nokia.ID}, 4)
+		check("page", ProductQuery{Sort: SortPriceAsc, Offset: 1, Limit: 2}, []uint{pixel.ID, iphone.ID}, 4)
+		check("by name", ProductQuery{Sort: SortNameAsc}, []uint{galaxy.ID, nokia.ID, pixel.ID, iphone.ID}, 4)
+
+		minPrice := int64(500000)
+		check("filtered", ProductQuery{
+			Sort:   SortPriceAsc,
+			Filter: ProductFilter{MinPriceMinor: &minPrice, InStockOnly: true},
+		}, []uint{pixel.ID, iphone.ID}, 2)
+		check("name contains", ProductQuery{Filter: ProductFilter{NameContains: "PHONE"}}, []uint{iphone.ID}, 1)
+
+		if err := b.products.Delete(ctx, galaxy.ID); err != nil {
+			t.Fatal(err)
+		}
+		check("catalogue", ProductQuery{Sort: SortPriceAsc}, []uint{nokia.ID, pixel.ID, iphone.ID}, 3)
+		check("deleted", ProductQuery{Listing: ListDeleted}, []uint{galaxy.ID}, 1)
+
+		first, second := int32(1), int32(2)
+		for id, rank := range map[uint]*int32{nokia.ID: &second, pixel.ID: &first, iphone.ID: &second} {
+			if err := b.products.SetFeaturedRank(ctx, id, rank); err != nil {
+				t.Fatal(err)
+			}
+		}
+		checkErr(t, "feature deleted", b.products.SetFeaturedRank(ctx, galaxy.ID, &first), ErrProductDiscontinued)
+		check("featured", ProductQuery{Listing: ListFeatured}, []uint{pixel.ID, nokia.ID, iphone.ID}, 3)
+		if err := b.products.SetFeaturedRank(ctx, nokia.ID, nil); err != nil {
+			t.Fatal(err)
+		}
+		check("unfeatured", ProductQuery{Listing: ListFeatured}, []uint{pixel.ID, iphone.ID}, 2)
+	})
+}
+
+func TestVariantStock(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b backend) {
+		ctx := context.Background()
+		product := createProduct(t, b, "Pixel 8", 6999900, 5)
+
+		black := models.Variant{
+			ProductID: product.ID,
+			SKU:       "PIXEL8-BLK",
+			Stock:     3,
+			Options:   []models.VariantOption{{Position: 0, Name: "color", Value: "Black"}},
+		}
+		if err := b.variants.Create(ctx, &black, "test"); err != nil {
+			t.Fatal(err)
+		}
+		if got, err := b.products.Get(ctx, product.ID, false); err != nil || got.Stock != 0 || len(got.Variants) != 1 {
+			t.Fatalf("after the first variant: stock %d, %d variants, %v", got.Stock, len(got.Variants), err)
+		}
+
+		taken := models.Variant{ProductID: product.ID, SKU: black.SKU}
+		checkErr(t, "taken sku", b.variants.Create(ctx, &taken, "test"), ErrSKUTaken)
+		same := models.Variant{
+			ProductID: product.ID,
+			SKU:       "PIXEL8-BLK2",
+			Options:   []models.VariantOption{{Name: "Color", Value: "black"}},
+		}
+		checkErr(t, "same options", b.variants.Create(ctx, &same, "test"), ErrDuplicateVariant)
+
+		stock := int32(7)
+		_, err := b.products.Update(ctx, product.ID, 1, ProductChange{Stock: &stock})
+		checkErr(t, "product stock", err, ErrVariantRequired)
+
+		own := StockItem{ProductID: product.ID}
+		item := StockItem{ProductID: product.ID, VariantID: black.ID}
+		sale := Movement{Reason: models.MovementSale, Caller: "test"}
+		checkErr(t, "reduce product", b.inventory.Reduce(ctx, own, 1, sale), ErrVariantRequired)
+		checkErr(t, "restore product", b.inventory.Restore(ctx, own, 1, sale), ErrVariantRequired)
+		checkErr(t, "reduce too much", b.inventory.Reduce(ctx, item, 4, sale), ErrInsufficientStock)
+		if err := b.inventory.Reduce(ctx, item, 2, sale); err != nil {
+			t.Fatal(err)
+		}
+
+		updated, err := b.variants.Update(ctx, black.ID, VariantChange{Stock: &stock, Caller: "test"})
+		if err != nil || updated.Stock != 7 || len(updated.Options) != 1 {
+			t.Fatalf("update: stock %d, %d options, %v", updated.Stock, len(updated.Options), err)
+		}
+
+		if err := b.variants.Delete(ctx, black.ID); err != nil {
+			t.Fatal(err)
+		}
+		checkErr(t, "delete again", b.variants.Delete(ctx, black.ID), ErrVariantNotFound)
+		checkErr(t, "reduce deleted", b.inventory.Reduce(ctx, item, 1, sale), ErrVariantNotFound)
+		if err := b.inventory.Restore(ctx, item, 1, Movement{Reason: models.MovementReservationRelease}); err != nil {
+			t.Errorf("restore deleted variant: %v", err)
+		}
+		unknown := StockItem{ProductID: product.ID, VariantID: black.ID + 100}
+		checkErr(t, "restore unknown", b.inventory.Restore(ctx, unknown, 1, sale), ErrVariantNotFound)
+
+		movements, err := b.inventory.Movements(ctx, MovementQuery{ProductID: product.ID, Limit: 10})
+		if err != nil {
+			t.Fatal(err)
+		}
+		type row struct {
+			variant        bool
+			delta, balance int32
+			reason         string
+		}
+		var got []row
+		for _, mv := range movements {
+			got = append(got, row{mv.VariantID != 0, mv.Delta, mv.Balance, mv.Reason})
+		}
+		want := []row{
+			{true, 1, 8, models.MovementReservationRelease},
+			{true, 6, 7, models.MovementAdminEdit},
+			{true, -2, 1, models.MovementSale},
+			{true, 3, 3, models.MovementInitial},
+			{false, -5, 0, models.MovementAdminEdit},
+			{false, 5, 5, models.MovementInitial},
+		}
+		if !slices.Equal(got, want) {
+			t.Errorf("ledger:\ngot  %v\nwant %v", got, want)
+		}
+		page, err := b.inventory.Movements(ctx, MovementQuery{ProductID: product.ID, VariantID: black.ID, Offset: 1, Limit: 2})
+		if err != nil || len(page) != 2 || page[0].Reason != models.MovementAdminEdit {
+			t.Errorf("variant page: %v, %v", page, err)
+		}
+	})
+}
+
+func TestAtomicallyRollsBack(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b backend) {
+		ctx := context.Background()
+		product := createProduct(t, b, "Pixel 8", 6999900, 5)
+		item := StockItem{ProductID: product.ID}
+		cutoff := time.Now().Add(-time.Hour)
+
+		errAbort := errors.New("abort")
+		err := b.inventory.Atomically(ctx, func(tx InventoryRepository) error {
+			if err := tx.Reduce(ctx, item, 2, Movement{Reason: models.MovementSale}); err != nil {
+				return err
+			}
+			if err := tx.SaveIdempotencyKey(ctx, models.IdempotencyKey{Method: "ReduceStock", Key: "k", RequestHash: "h"}, cutoff); err != nil {
+				return err
+			}
+			return errAbort
+		})
+		checkErr(t, "atomically", err, errAbort)
+
+		if got, err := b.products.Get(ctx, product.ID, false); err != nil || got.Stock != 5 {
+			t.Errorf("stock after rollback: %d, %v", got.Stock, err)
+		}
+		if movements, err := b.inventory.Movements(ctx, MovementQuery{ProductID: product.ID, Limit: 10}); err != nil || len(movements) != 1 {
+			t.Errorf("ledger after rollback: %d movements, %v", len(movements), err)
+		}
+		_, err = b.inventory.IdempotencyKey(ctx, "ReduceStock", "k", cutoff)
+		checkErr(t, "key after rollback", err, ErrIdempotencyKeyUnknown)
+
+		err = b.inventory.Atomically(ctx, func(tx InventoryRepository) error {
+			return tx.Reduce(ctx, item, 2, Movement{Reason: models.MovementSale})
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, err := b.products.Get(ctx, product.ID, false); err != nil || got.Stock != 3 {
+			t.Errorf("stock after commit: %d, %v", got.Stock, err)
+		}
+	})
+}
+
+func TestReservations(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b backend) {
+		ctx := context.Background()
+		pixel := createProduct(t, b, "Pixel 8", 6999900, 5)
+		nokia := createProduct(t, b, "Nokia 105", 149900, 10)
+		now := time.Now()
+
+		reserve := func(expiresAt time.Time, items ...models.ReservationItem) models.Reservation {
+			t.Helper()
+			reservation := models.Reservation{Status: models.ReservationPending, ExpiresAt: expiresAt, Items: items}
+			if err := b.inventory.CreateReservation(ctx, &reservation); err != nil {
+				t.Fatal(err)
+			}
+			return reservation
+		}
+		stale := reserve(now.Add(-time.Minute),
+			models.ReservationItem{ProductID: nokia.ID, Quantity: 1},
+			models.ReservationItem{ProductID: pixel.ID, Quantity: 2})
+		live := reserve(now.Add(time.Hour), models.ReservationItem{ProductID: pixel.ID, Quantity: 1})
+
+		expired, err := b.inventory.ExpiredReservations(ctx, now, 10)
+		if err != nil || !slices.Equal(expired, []uint{stale.ID}) {
+			t.Errorf("expired: %v, %v", expired, err)
+		}
+		checkErr(t, "commit expired", b.inventory.CommitReservation(ctx, stale.ID, now), ErrReservationState)
+		checkErr(t, "commit unknown", b.inventory.CommitReservation(ctx, live.ID+100, now), ErrReservationNotFound)
+
+		finished, err := b.inventory.FinishReservation(ctx, stale.ID, models.ReservationExpired)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(finished.Items) != 2 || finished.Items[0].ProductID != pixel.ID || finished.Status != models.ReservationExpired {
+			t.Errorf("finished: status %q, items %v", finished.Status, finished.Items)
+		}
+		_, err = b.inventory.FinishReservation(ctx, stale.ID, models.ReservationReleased)
+		checkErr(t, "finish again", err, ErrReservationState)
+
+		// The pending reservation holds pixel, nokia is free to go.
+		for _, id := range []uint{pixel.ID, nokia.ID} {
+			if err := b.products.Delete(ctx, id); err != nil {
+				t.Fatal(err)
+			}
+		}
+		checkErr(t, "purge held", b.products.Purge(ctx, pixel.ID), ErrProductInUse)
+		purgeable, err := b.products.Purgeable(ctx, time.Now().Add(time.Minute), 10)
+		if err != nil || !slices.Equal(purgeable, []uint{nokia.ID}) {
+			t.Errorf("purgeable: %v, %v", purgeable, err)
+		}
+
+		if err := b.inventory.CommitReservation(ctx, live.ID, now); err != nil {
+			t.Fatal(err)
+		}
+		if got, err := b.inventory.Reservation(ctx, live.ID); err != nil || got.Status != models.ReservationCommitted {
+			t.Errorf("committed: status %q, %v", got.Status, err)
+		}
+		_, err = b.inventory.Reservation(ctx, live.ID+100)
+		checkErr(t, "unknown", err, ErrReservationNotFound)
+		if err := b.products.Purge(ctx, pixel.ID); err != nil {
+			t.Errorf("purge released: %v", err)
+		}
+	})
+}
+
+func TestIdempotencyKeys(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b backend) {
+		ctx := context.Background()
+		now := time.Now()
+		record := models.IdempotencyKey{Method: "ReduceStock", Key: "k", RequestHash: "h", Response: []byte("first")}
+
+		if err := b.inventory.SaveIdempotencyKey(ctx, record, now.Add(-time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+		checkErr(t, "save again", b.inventory.SaveIdempotencyKey(ctx, record, now.Add(-time.Hour)), ErrIdempotencyKeyTaken)
+		if got, err := b.inventory.IdempotencyKey(ctx, "ReduceStock", "k", now.Add(-time.Hour)); err != nil || string(got.Response) != "first" {
+			t.Errorf("load: %q, %v", got.Response, err)
+		}
+		_, err := b.inventory.IdempotencyKey(ctx, "RestoreStock", "k", now.Add(-time.Hour))
+		checkErr(t, "other method", err, ErrIdempotencyKeyUnknown)
+
+		// Past its retention window the record no longer counts.
+		later := now.Add(time.Hour)
+		_, err = b.inventory.IdempotencyKey(ctx, "ReduceStock", "k", later)
+		checkErr(t, "expired", err, ErrIdempotencyKeyUnknown)
+		record.Response, record.CreatedAt = []byte("second"), later
+		if err := b.inventory.SaveIdempotencyKey(ctx, record, later); err != nil {
+			t.Fatal(err)
+		}
+		if got, err := b.inventory.IdempotencyKey(ctx, "ReduceStock", "k", later); err != nil || string(got.Response) != "second" {
+			t.Errorf("replaced: %q, %v", got.Response, err)
+		}
+
+		if err := b.inventory.DeleteIdempotencyKeys(ctx, later.Add(time.Second)); err != nil {
+			t.Fatal(err)
+		}
+		_, err = b.inventory.IdempotencyKey(ctx, "ReduceStock", "k", now)
+		checkErr(t, "deleted", err, ErrIdempotencyKeyUnknown)
+	})
+}
@@ -0,0 +1,199 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Manuelmastro/mobilehub-product/v3/pkg/models"
+	"github.com/Manuelmastro/mobilehub-product/v3/pkg/pb"
+	"github.com/Manuelmastro/mobilehub-product/v3/pkg/repository"
+	"github.com/Manuelmastro/mobilehub-product/v3/pkg/slug"
+	"github.com/Manuelmastro/mobilehub-product/v3/pkg/validation"
+	"google.golang.org/grpc/codes"
+)
+
+var (
+	errCategoryNotFound  = repository.ErrCategoryNotFound
+	errCategoryInUse     = repository.ErrCategoryInUse
+	errCategorySlugTaken = repository.ErrCategorySlugTaken
+	errInvalidParent     = repository.ErrInvalidParent
+)
+
+func categoryToProto(c models.Category) *pb.Category {
+	category := &pb.Category{
+		Id:        int64(c.ID),
+		Name:      c.Name,
+		Slug:      c.Slug,
+		SortOrder: c.SortOrder,
+	}
+	if c.ParentID != nil {
+		category.ParentId = int64(*c.ParentID)
+	}
+	return category
+}
+
+// resolveCategory finds the category a product request names, by ID or by
+// the deprecated name. Names match case-insensitively or through their slug,
+// so "smart phones" still finds "Smart Phones" and "Smartphones".
+func (s *ProductServiceServer) resolveCategory(ctx context.Context, id int64, name string) (uint, error) {
+	name = strings.TrimSpace(name)
+	category, err := s.Categories.Resolve(ctx, uint(id), name)
+	if errors.Is(err, errCategoryNotFound) {
+		metadata := map[string]string{"category_id": fmt.Sprint(id)}
+		if id == 0 {
+			metadata = map[string]string{"category_name": name}
+		}
+		return 0, statusError(codes.InvalidArgument, pb.ErrorReason_CATEGORY_NOT_FOUND, "unknown category", metadata)
+	}
+	if err != nil {
+		return 0, internalError("failed to fetch category", err)
+	}
+	return category.ID, nil
+}
+
+func parentIDPtr(parentID int64) *uint {
+	if parentID == 0 {
+		return nil
+	}
+	id := uint(parentID)
+	return &id
+}
+
+func (s *ProductServiceServer) CreateCategory(ctx context.Context, req *pb.CreateCategoryRequest) (*pb.CreateCategoryResponse, error) {
+	if err := validation.CreateCategory(req); err != nil {
+		return nil, validationError(err)
+	}
+
+	category := models.Category{
+		Name:      strings.TrimSpace(req.Name),
+		Slug:      req.Slug,
+		ParentID:  parentIDPtr(req.ParentId),
+		SortOrder: req.SortOrder,
+	}
+	if category.Slug == "" {
+		category.Slug = slug.Make(category.Name)
+	}
+
+	if err := s.Categories.Create(ctx, &category); err != nil {
+		return nil, categoryError(err, req.ParentId, category.Slug, "failed to create category")
+	}
+
+	return &pb.CreateCategoryResponse{Category: categoryToProto(category)}, nil
+}
+
+func (s *ProductServiceServer) GetCategory(ctx context.Context, req *pb.GetCategoryRequest) (*pb.GetCategoryResponse, error) {
+	category, err := s.Categories.Get(ctx, uint(req.Id))
+	if err != nil {
+		return nil, categoryError(err, req.Id, "", "failed to fetch category")
+	}
+
+	return &pb.GetCategoryResponse{Category: categoryToProto(category)}, nil
+}
+
+func (s *ProductServiceServer) UpdateCategory(ctx context.Context, req *pb.UpdateCategoryRequest) (*pb.UpdateCategoryResponse, error) {
+	if err := validation.UpdateCategory(req); err != nil {
+		return nil, validationError(err)
+	}
+
+	var change repository.CategoryChange
+	for _, path := range validation.CategoryMask(req) {
+		switch path {
+		case validation.CategoryPathName:
+			name := strings.TrimSpace(req.Name)
+			change.Name = &name
+		case validation.CategoryPathSlug:
+			change.Slug = &req.Slug
+		case validation.CategoryPathParent:
+			parentID := uint(req.ParentId)
+			change.ParentID = &parentID
+		case validation.CategoryPathSortOrder:
+			change.SortOrder = &req.SortOrder
+		}
+	}
+
+	category, err := s.Categories.Update(ctx, uint(req.Id), change)
+	if errors.Is(err, repository.ErrCategorySlugRequired) {
+		return nil, validationError(validation.Violations{{Field: "slug", Description: "is required when the name has no letters or digits"}})
+	}
+	if err != nil {
+		return nil, categoryError(err, req.Id, category.Slug, "failed to update category")
+	}
+
+	return &pb.UpdateCategoryResponse{Category: categoryToProto(category)}, nil
+}
+
+// DeleteCategory removes an unused category and its offers. Deleted products
+// still count as users, they keep their category for as long as they can be
+// restored.
+func (s *ProductServiceServer) DeleteCategory(ctx context.Context, req *pb.DeleteCategoryRequest) (*pb.DeleteCategoryResponse, error) {
+	err := s.Categories.Delete(ctx, uint(req.Id))
+	if err != nil {
+		return nil, categoryError(err, req.Id, "", "failed to delete category")
+	}
+
+	return &pb.DeleteCategoryResponse{
+		Status:  true,
+		Message: "Category deleted successfully",
+	}, nil
+}
+
+func (s *ProductServiceServer) GetCategoryTree(ctx context.Context, req *pb.GetCategoryTreeRequest) (*pb.GetCategoryTreeResponse, error) {
+	categories, err := s.Categories.List(ctx)
+	if err != nil {
+		return nil, internalError("failed to fetch categories", err)
+	}
+
+	children := map[uint][]models.Category{}
+	var roots []models.Category
+	for _, c := range categories {
+		switch {
+		case req.RootId != 0 && c.ID == uint(req.RootId):
+			roots = append(roots, c)
+		case req.RootId == 0 && c.ParentID == nil:
+			roots = append(roots, c)
+		}
+		if c.ParentID != nil {
+			children[*c.ParentID] = append(children[*c.ParentID], c)
+		}
+	}
+	if req.RootId != 0 && len(roots) == 0 {
+		return nil, categoryError(errCategoryNotFound, req.RootId, "", "")
+	}
+
+	var node func(c models.Category) *pb.CategoryNode
+	node = func(c models.Category) *pb.CategoryNode {
+		n := &pb.CategoryNode{Category: categoryToProto(c)}
+		for _, child := range children[c.ID] {
+			n.Children = append(n.Children, node(child))
+		}
+		return n
+	}
+
+	response := &pb.GetCategoryTreeResponse{}
+	for _, root := range roots {
+		response.Roots = append(response.Roots, node(root))
+	}
+	return response, nil
+}
+
+// categoryError maps the errors of the category RPCs to statuses.
+func categoryError(err error, id int64, taken string, msg string) error {
+	switch {
+	case errors.Is(err, errCategoryNotFound):
+		return statusError(codes.NotFound, pb.ErrorReason_CATEGORY_NOT_FOUND, "category not found",
+			map[string]string{"category_id": fmt.Sprint(id)})
+	case errors.Is(err, errInvalidParent):
+		return statusError(codes.InvalidArgument, pb.ErrorReason_INVALID_CATEGORY_PARENT,
+			"parent must be an existing category outside this one's subtree", nil)
+	case errors.Is(err, errCategoryInUse):
+		return statusError(codes.FailedPrecondition, pb.ErrorReason_CATEGORY_IN_USE,
+			"category still has products or subcategories", map[string]string{"category_id": fmt.Sprint(id)})
+	case errors.Is(err, errCategorySlugTaken):
+		return statusError(codes.AlreadyExists, pb.ErrorReason_CATEGORY_SLUG_TAKEN, "category slug is taken",
+			map[string]string{"slug": taken})
+	default:
+		return internalError(msg, err)
+	}
+}
@@ -0,0 +1,146 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Manuelmastro/mobilehub-product/v3/pkg/models"
+	"github.com/Manuelmastro/mobilehub-product/v3/pkg/pb"
+	"github.com/Manuelmastro/mobilehub-product/v3/pkg/slug"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+	"gorm.io/gorm"
+)
+
+func createTestCategory(t *testing.T, gormDB *gorm.DB, name string) models.Category {
+	t.Helper()
+	category := models.Category{Name: name, Slug: slug.Make(t.Name() + " " + name)}
+	if err := gormDB.Create(&category).Error; err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { gormDB.Delete(&category) })
+	return category
+}
+
+func TestCategoryTree(t *testing.T) {
+	s, gormDB := newTestServer(t)
+	ctx := context.Background()
+
+	create := func(name string, parent int64, order int32) *pb.Category {
+		t.Helper()
+		res, err := s.CreateCategory(ctx, &pb.CreateCategoryRequest{
+			Name:      name,
+			Slug:      slug.Make("tree test " + name),
+			ParentId:  parent,
+			SortOrder: order,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res.Category
+	}
+
+	phones := create("Phones", 0, 0)
+	t.Cleanup(func() { gormDB.Delete(&models.Category{}, phones.Id) })
+	android := create("Android", phones.Id, 2)
+	t.Cleanup(func() { gormDB.Delete(&models.Category{}, android.Id) })
+	iphone := create("iPhone", phones.Id, 1)
+	t.Cleanup(func() { gormDB.Delete(&models.Category{}, iphone.Id) })
+
+	tree, err := s.GetCategoryTree(ctx, &pb.GetCategoryTreeRequest{RootId: phones.Id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tree.Roots) != 1 || len(tree.Roots[0].Children) != 2 ||
+		tree.Roots[0].Children[0].Category.Id != iphone.Id || tree.Roots[0].Children[1].Category.Id != android.Id {
+		t.Fatalf("tree = %v, want Phones with iPhone before Android", tree.Roots)
+	}
+
+	// A category cannot move below its own subtree.
+	_, err = s.UpdateCategory(ctx, &pb.UpdateCategoryRequest{
+		Id:         phones.Id,
+		ParentId:   android.Id,
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"parent_id"}},
+	})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("move below own child: got %v, want InvalidArgument", err)
+	}
+
+	_, err = s.CreateCategory(ctx, &pb.CreateCategoryRequest{Name: "Phones again", Slug: phones.Slug})
+	if status.Code(err) != codes.AlreadyExists {
+		t.Fatalf("duplicate slug: got %v, want AlreadyExists", err)
+	}
+
+	// Products in a subcategory show up when filtering by the parent, and
+	// keep the category from being deleted.
+	product := models.Product{ProductName: "tree test phone", CategoryID: ptr(uint(android.Id))}
+	if err := gormDB.Create(&product).Error; err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { gormDB.Unscoped().Delete(&product) })
+
+	page, err := s.GetProducts(ctx, &pb.GetProductsRequest{Filter: &pb.ProductFilter{CategoryId: phones.Id}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Products) != 1 || page.Products[0].CategoryName != "Android" {
+		t.Fatalf("products under Phones = %v, want the Android product", page.Products)
+	}
+
+	_, err = s.DeleteCategory(ctx, &pb.DeleteCategoryRequest{Id: android.Id})
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("delete category in use: got %v, want FailedPrecondition", err)
+	}
+	if _, err := s.DeleteCategory(ctx, &pb.DeleteCategoryRequest{Id: iphone.Id}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Deprecated category names find the category migration 0004 merged their
+// spelling into, whatever the dashes of its slug.
+func TestAddProductCategorySpelling(t *testing.T) {
+	ctx := context.Background()
+	add := func(t *testing.T, s *ProductServiceServer, category models.Category) {
+		t.Helper()
+		name := "spelling test phone"
+		if _, err := s.AddProduct(ctx, &pb.AddProductRequest{
+			ProductName:  name,
+			CategoryName: "Spelling Test Smart Phones",
+			ListPrice:    &pb.Money{CurrencyCode: "INR", Units: 19999},
+		}); err != nil {
+			t.Fatal(err)
+		}
+		res, err := s.GetProducts(ctx, &pb.GetProductsRequest{
+			Filter: &pb.ProductFilter{CategoryId: int64(category.ID), NameContains: name},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(res.Products) != 1 || res.Products[0].CategoryName != category.Name {
+			t.Fatalf("products = %v, want one in %q", res.Products, category.Name)
+		}
+	}
+
+	t.Run("gorm", func(t *testing.T) {
+		s, gormDB := newTestServer(t)
+		category := models.Category{Name: "Spelling Test Smartphones", Slug: "spelling-test-smartphones"}
+		if err := gormDB.Create(&category).Error; err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() {
+			gormDB.Unscoped().Where("category_id = ?", category.ID).Delete(&models.Product{})
+			gormDB.Delete(&category)
+		})
+		add(t, s, category)
+	})
+
+	t.Run("memory", func(t *testing.T) {
+		s, products := newMemoryServer(t)
+		add(t, s, products.AddCategory(models.Category{Name: "Spelling Test Smartphones", Slug: "spelling-test-smartphones"}))
+	})
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
@@ -0,0 +1,128 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Manuelmastro/mobilehub-product/v3/pkg/pb"
+	"github.com/Manuelmastro/mobilehub-product/v3/pkg/repository"
+	"google.golang.org/grpc/codes"
+)
+
+var (
+	errProductNotDeleted = repository.ErrProductNotDeleted
+	errProductInUse      = repository.ErrProductInUse
+)
+
+// purgeBatchSize bounds how many products one run of the purge job removes.
+const purgeBatchSize = 100
+
+func (s *ProductServiceServer) ListDeletedProducts(ctx context.Context, req *pb.ListDeletedProductsRequest) (*pb.ListDeletedProductsResponse, error) {
+	page, err := s.listProducts(ctx, productQuery{
+		PageSize:  req.PageSize,
+		PageToken: req.PageToken,
+		Filter:    req.Filter,
+		Listing:   repository.ListDeleted,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := s.productsToProto(ctx, page.Products)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.ListDeletedProductsResponse{
+		Products:      response,
+		NextPageToken: page.NextPageToken,
+		TotalCount:    page.TotalCount,
+	}, nil
+}
+
+func (s *ProductServiceServer) RestoreProduct(ctx context.Context, req *pb.RestoreProductRequest) (*pb.RestoreProductResponse, error) {
+	productID, err := parseProductID(req.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.Products.Restore(ctx, productID); err != nil {
+		return nil, deletedProductError(err, productID, "failed to restore product")
+	}
+
+	product, err := s.findProduct(ctx, productID, false)
+	if err != nil {
+		return nil, err
+	}
+	prices, err := s.pricing(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.RestoreProductResponse{
+		Status:  true,
+		Message: "Product restored successfully",
+		Product: productToProto(product, prices),
+	}, nil
+}
+
+// PurgeProduct removes a deleted product for good. Live products have to be
+// deleted first, so a single call can never lose a product by mistake.
+func (s *ProductServiceServer) PurgeProduct(ctx context.Context, req *pb.PurgeProductRequest) (*pb.PurgeProductResponse, error) {
+	productID, err := parseProductID(req.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.Products.Purge(ctx, productID); err != nil {
+		return nil, deletedProductError(err, productID, "failed to purge product")
+	}
+
+	return &pb.PurgeProductResponse{
+		Status:  true,
+		Message: "Product purged successfully",
+	}, nil
+}
+
+// PurgeDeletedProducts hard-deletes products that were soft-deleted longer
+// than the retention window ago. It is run periodically by the purge job.
+// Products still held by pending reservations wait for a later run.
+func (s *ProductServiceServer) PurgeDeletedProducts(ctx context.Context) error {
+	if s.DeletedProductRetention <= 0 {
+		return nil
+	}
+
+	ids, err := s.Products.Purgeable(ctx, time.Now().Add(-s.DeletedProductRetention), purgeBatchSize)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		err := s.Products.Purge(ctx, id)
+		if err != nil && !errors.Is(err, errProductNotFound) &&
+			!errors.Is(err, errProductNotDeleted) && !errors.Is(err, errProductInUse) {
+			return err
+		}
+	}
+	return nil
+}
+
+// deletedProductError maps the errors of restoring and purging to statuses.
+func deletedProductError(err error, productID uint, msg string) error {
+	switch {
+	case errors.Is(err, errProductDiscontinued):
+		return productDiscontinued(productID)
+	case errors.Is(err, errProductNotFound):
+		return productNotFound(productID)
+	case errors.Is(err, errProductNotDeleted):
+		return statusError(codes.FailedPrecondition, pb.ErrorReason_PRODUCT_NOT_DELETED,
+			"product is not deleted", map[string]string{"product_id": fmt.Sprint(productID)})
+	case errors.Is(err, errProductInUse):
+		return statusError(codes.FailedPrecondition, pb.ErrorReason_PRODUCT_IN_USE,
+			"pending reservations still hold stock of the product", map[string]string{"product_id": fmt.Sprint(productID)})
+	default:
+		return internalError(msg, err)
+	}
+}
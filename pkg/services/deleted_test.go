@@ -0,0 +1,178 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Manuelmastro/mobilehub-product/v3/pkg/models"
+	"github.com/Manuelmastro/mobilehub-product/v3/pkg/pb"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestDeleteRestorePurgeProduct(t *testing.T) {
+	s, gormDB := newTestServer(t)
+	ctx := context.Background()
+
+	product := models.Product{ProductName: "deleted product test", Stock: 5}
+	if err := gormDB.Create(&product).Error; err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { gormDB.Unscoped().Delete(&product) })
+	id := fmt.Sprint(product.ID)
+
+	// A live product can be neither restored nor purged.
+	if _, err := s.RestoreProduct(ctx, &pb.RestoreProductRequest{Id: id}); status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("restore of live product: got %v, want FailedPrecondition", err)
+	}
+	if _, err := s.PurgeProduct(ctx, &pb.PurgeProductRequest{Id: id}); status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("purge of live product: got %v, want FailedPrecondition", err)
+	}
+
+	if _, err := s.DeleteProduct(ctx, &pb.DeleteProductRequest{Id: id}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Deleted products are discontinued, readable for order history only.
+	_, err := s.GetProduct(ctx, &pb.GetProductRequest{Id: id})
+	if reason := errorReason(err); status.Code(err) != codes.NotFound || reason != pb.ErrorReason_PRODUCT_DISCONTINUED.String() {
+		t.Fatalf("get deleted product: got %v (%s), want NotFound PRODUCT_DISCONTINUED", err, reason)
+	}
+	history, err := s.GetProduct(ctx, &pb.GetProductRequest{Id: id, IncludeDeleted: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !history.Product.Discontinued {
+		t.Errorf("product read with includeDeleted is not marked discontinued")
+	}
+	_, err = s.ReduceStock(ctx, &pb.ReduceStockRequest{ProductId: int64(product.ID), Quantity: 1})
+	if reason := errorReason(err); reason != pb.ErrorReason_PRODUCT_DISCONTINUED.String() {
+		t.Fatalf("reduce stock of deleted product: got %v, want PRODUCT_DISCONTINUED", err)
+	}
+
+	deleted, err := s.ListDeletedProducts(ctx, &pb.ListDeletedProductsRequest{
+		Filter: &pb.ProductFilter{NameContains: "deleted product test"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deleted.Products) != 1 || deleted.Products[0].Id != id || deleted.Products[0].DeletedAt == nil {
+		t.Fatalf("deleted products = %v, want product %s with deletedAt", deleted.Products, id)
+	}
+
+	restored, err := s.RestoreProduct(ctx, &pb.RestoreProductRequest{Id: id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored.Product.DeletedAt != nil || restored.Product.Stock != 5 {
+		t.Errorf("restored product = %v", restored.Product)
+	}
+
+	// A pending reservation blocks the purge until it is released.
+	res, err := s.ReserveStock(ctx, &pb.ReserveStockRequest{
+		Lines: []*pb.StockLine{{ProductId: int64(product.ID), Quantity: 2}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.DeleteProduct(ctx, &pb.DeleteProductRequest{Id: id}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.PurgeProduct(ctx, &pb.PurgeProductRequest{Id: id}); status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("purge with pending reservation: got %v, want FailedPrecondition", err)
+	}
+	if _, err := s.ReleaseReservation(ctx, &pb.ReleaseReservationRequest{ReservationId: res.ReservationId}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.PurgeProduct(ctx, &pb.PurgeProductRequest{Id: id}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.RestoreProduct(ctx, &pb.RestoreProductRequest{Id: id}); status.Code(err) != codes.NotFound {
+		t.Errorf("restore of purged product: got %v, want NotFound", err)
+	}
+}
+
+// errorReason returns the ErrorInfo reason of a status error.
+func errorReason(err error) string {
+	for _, detail := range status.Convert(err).Details() {
+		if info, ok := detail.(*errdetails.ErrorInfo); ok {
+			return info.Reason
+		}
+	}
+	return ""
+}
+
+func TestPurgeDeletedProductsHonoursRetention(t *testing.T) {
+	s, gormDB := newTestServer(t)
+	s.DeletedProductRetention = 24 * time.Hour
+
+	old := models.Product{ProductName: "purge old"}
+	recent := models.Product{ProductName: "purge recent"}
+	for _, p := range []*models.Product{&old, &recent} {
+		if err := gormDB.Create(p).Error; err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { gormDB.Unscoped().Delete(p) })
+	}
+	if err := gormDB.Model(&old).Update("deleted_at", time.Now().Add(-48*time.Hour)).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := gormDB.Delete(&recent).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.PurgeDeletedProducts(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	var ids []uint
+	if err := gormDB.Unscoped().Model(&models.Product{}).
+		Where("id IN ?", []uint{old.ID, recent.ID}).
+		Pluck("id", &ids).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 1 || ids[0] != recent.ID {
+		t.Errorf("remaining products = %v, want only %d", ids, recent.ID)
+	}
+}
+
+func TestPurgeHeldProductInMemory(t *testing.T) {
+	s, products := newMemoryServer(t)
+	s.DeletedProductRetention = time.Nanosecond
+	ctx := context.Background()
+
+	product := models.Product{ProductName: "held product"}
+	if err := products.Create(ctx, &product, ""); err != nil {
+		t.Fatal(err)
+	}
+	id := fmt.Sprint(product.ID)
+	if _, err := s.DeleteProduct(ctx, &pb.DeleteProductRequest{Id: id}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Stock a pending reservation holds keeps the product around.
+	products.Hold(product.ID, true)
+	_, err := s.PurgeProduct(ctx, &pb.PurgeProductRequest{Id: id})
+	if reason := errorReason(err); reason != pb.ErrorReason_PRODUCT_IN_USE.String() {
+		t.Fatalf("purge of held product: got %v, want PRODUCT_IN_USE", err)
+	}
+	if err := s.PurgeDeletedProducts(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetProduct(ctx, &pb.GetProductRequest{Id: id, IncludeDeleted: true}); err != nil {
+		t.Fatalf("held product was purged: %v", err)
+	}
+
+	products.Hold(product.ID, false)
+	if err := s.PurgeDeletedProducts(ctx); err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.GetProduct(ctx, &pb.GetProductRequest{Id: id, IncludeDeleted: true})
+	if reason := errorReason(err); reason != pb.ErrorReason_PRODUCT_NOT_FOUND.String() {
+		t.Fatalf("get purged product: got %v, want PRODUCT_NOT_FOUND", err)
+	}
+}
@@ -0,0 +1,610 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Manuelmastro/mobilehub-product/v3/pkg/auth"
+	"github.com/Manuelmastro/mobilehub-product/v3/pkg/models"
+	"github.com/Manuelmastro/mobilehub-product/v3/pkg/pb"
+	"github.com/golang-jwt/jwt/v5"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"gorm.io/gorm"
+)
+
+// e2eSecret signs the tokens of the end-to-end tests.
+const e2eSecret = "e2e-secret"
+
+// newTestClient serves newTestServer on an in-memory listener, behind the
+// interceptors cmd/main.go installs, and returns a client connected to it.
+// The server and its database are returned too, for the jobs the service
+// runs on a timer and for the tests to look behind the API.
+func newTestClient(t *testing.T) (pb.ProductServiceClient, *ProductServiceServer, *gorm.DB) {
+	t.Helper()
+	s, gormDB := newTestServer(t)
+
+	keys, err := auth.ParseKeySet("e2e:" + e2eSecret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	interceptor := auth.NewInterceptor(auth.NewVerifier(keys, ""), auth.ProductServicePolicy)
+	grpcServer := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(interceptor.Unary()),
+		grpc.ChainStreamInterceptor(interceptor.Stream()),
+	)
+	pb.RegisterProductServiceServer(grpcServer, s)
+
+	lis := bufconn.Listen(1 << 20)
+	go grpcServer.Serve(lis)
+	t.Cleanup(grpcServer.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return pb.NewProductServiceClient(conn), s, gormDB
+}
+
+// as returns a context calling with a token of role.
+func as(t *testing.T, role string) context.Context {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, auth.Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   "e2e-" + role,
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+		Role: role,
+	})
+	token.Header["kid"] = "e2e"
+	signed, err := token.SignedString([]byte(e2eSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+signed)
+}
+
+// wantError fails the test unless err has code and reason.
+func wantError(t *testing.T, what string, err error, code codes.Code, reason pb.ErrorReason) {
+	t.Helper()
+	if status.Code(err) != code || errorReason(err) != reason.String() {
+		t.Fatalf("%s: got %v, want %v %v", what, err, code, reason)
+	}
+}
+
+// badFields lists the fields of the BadRequest detail of err.
+func badFields(err error) []string {
+	var fields []string
+	for _, detail := range status.Convert(err).Details() {
+		if badRequest, ok := detail.(*errdetails.BadRequest); ok {
+			for _, v := range badRequest.FieldViolations {
+				fields = append(fields, v.Field)
+			}
+		}
+	}
+	return fields
+}
+
+// addE2EProduct adds a product to category through the API and returns it.
+func addE2EProduct(t *testing.T, client pb.ProductServiceClient, category int64, name string, units int64, stock int32) *pb.Product {
+	t.Helper()
+	admin := as(t, auth.RoleAdmin)
+	if _, err := client.AddProduct(admin, &pb.AddProductRequest{
+		ProductName: name,
+		CategoryId:  category,
+		ListPrice:   &pb.Money{CurrencyCode: "INR", Units: units},
+		Stock:       stock,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	res, err := client.GetProducts(context.Background(), &pb.GetProductsRequest{
+		Filter: &pb.ProductFilter{CategoryId: category, NameContains: name},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Products) != 1 {
+		t.Fatalf("products named %q = %v, want the one added", name, res.Products)
+	}
+	return res.Products[0]
+}
+
+// createE2ECategory creates a category through the API. The category goes
+// when the test ends, with its products and offers.
+func createE2ECategory(t *testing.T, client pb.ProductServiceClient, gormDB *gorm.DB, name string, parent int64) *pb.Category {
+	t.Helper()
+	res, err := client.CreateCategory(as(t, auth.RoleAdmin), &pb.CreateCategoryRequest{Name: name, ParentId: parent})
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := res.Category.Id
+	t.Cleanup(func() {
+		gormDB.Where("category_id = ?", id).Delete(&models.Offer{})
+		gormDB.Unscoped().Where("category_id = ?", id).Delete(&models.Product{})
+		gormDB.Delete(&models.Category{}, id)
+	})
+	return res.Category
+}
+
+func productStock(t *testing.T, client pb.ProductServiceClient, id string) int32 {
+	t.Helper()
+	res, err := client.GetProduct(context.Background(), &pb.GetProductRequest{Id: id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res.Product.Stock
+}
+
+func productID(t *testing.T, p *pb.Product) int64 {
+	t.Helper()
+	id, err := strconv.ParseInt(p.Id, 10, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func TestE2EAuthorization(t *testing.T) {
+	client, _, _ := newTestClient(t)
+
+	_, err := client.AddProduct(context.Background(), &pb.AddProductRequest{ProductName: "no token"})
+	wantError(t, "AddProduct without token", err, codes.Unauthenticated, pb.ErrorReason_UNAUTHENTICATED)
+
+	_, err = client.ReduceStock(as(t, auth.RoleAdmin), &pb.ReduceStockRequest{ProductId: 1, Quantity: 1})
+	wantError(t, "ReduceStock as admin", err, codes.PermissionDenied, pb.ErrorReason_PERMISSION_DENIED)
+
+	_, err = client.DeleteProduct(as(t, auth.RoleService), &pb.DeleteProductRequest{Id: "1"})
+	wantError(t, "DeleteProduct as service", err, codes.PermissionDenied, pb.ErrorReason_PERMISSION_DENIED)
+}
+
+func TestE2ECategories(t *testing.T) {
+	client, _, gormDB := newTestClient(t)
+	admin := as(t, auth.RoleAdmin)
+	ctx := context.Background()
+
+	phones := createE2ECategory(t, client, gormDB, "E2E Phones", 0)
+	android := createE2ECategory(t, client, gormDB, "E2E Android", phones.Id)
+	if phones.Slug != "e2e-phones" || android.ParentId != phones.Id {
+		t.Fatalf("categories = %v and %v", phones, android)
+	}
+
+	_, err := client.CreateCategory(admin, &pb.CreateCategoryRequest{Name: "E2E phones!"})
+	wantError(t, "CreateCategory with a taken slug", err, codes.AlreadyExists, pb.ErrorReason_CATEGORY_SLUG_TAKEN)
+
+	got, err := client.GetCategory(ctx, &pb.GetCategoryRequest{Id: android.Id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Category.Name != "E2E Android" {
+		t.Errorf("GetCategory = %v", got.Category)
+	}
+	_, err = client.GetCategory(ctx, &pb.GetCategoryRequest{Id: 999999})
+	wantError(t, "GetCategory of unknown id", err, codes.NotFound, pb.ErrorReason_CATEGORY_NOT_FOUND)
+
+	updated, err := client.UpdateCategory(admin, &pb.UpdateCategoryRequest{
+		Id:         android.Id,
+		Name:       "E2E Android Phones",
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"name"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.Category.Name != "E2E Android Phones" || updated.Category.Slug != android.Slug {
+		t.Errorf("UpdateCategory = %v, want the name changed only", updated.Category)
+	}
+	_, err = client.UpdateCategory(admin, &pb.UpdateCategoryRequest{
+		Id:         phones.Id,
+		ParentId:   android.Id,
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"parent_id"}},
+	})
+	wantError(t, "UpdateCategory under its own child", err, codes.InvalidArgument, pb.ErrorReason_INVALID_CATEGORY_PARENT)
+
+	tree, err := client.GetCategoryTree(ctx, &pb.GetCategoryTreeRequest{RootId: phones.Id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tree.Roots) != 1 || len(tree.Roots[0].Children) != 1 || tree.Roots[0].Children[0].Category.Id != android.Id {
+		t.Fatalf("GetCategoryTree = %v, want phones with android below", tree.Roots)
+	}
+
+	_, err = client.DeleteCategory(admin, &pb.DeleteCategoryRequest{Id: phones.Id})
+	wantError(t, "DeleteCategory with a subcategory", err, codes.FailedPrecondition, pb.ErrorReason_CATEGORY_IN_USE)
+	for _, id := range []int64{android.Id, phones.Id} {
+		if _, err := client.DeleteCategory(admin, &pb.DeleteCategoryRequest{Id: id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err = client.DeleteCategory(admin, &pb.DeleteCategoryRequest{Id: phones.Id})
+	wantError(t, "DeleteCategory twice", err, codes.NotFound, pb.ErrorReason_CATEGORY_NOT_FOUND)
+}
+
+func TestE2EProductLifecycle(t *testing.T) {
+	client, _, gormDB := newTestClient(t)
+	admin := as(t, auth.RoleAdmin)
+	ctx := context.Background()
+
+	category := createE2ECategory(t, client, gormDB, "E2E Tablets", 0)
+	tab := addE2EProduct(t, client, category.Id, "e2e tab s9", 69999, 5)
+	addE2EProduct(t, client, category.Id, "e2e tab a9", 14999, 0)
+
+	_, err := client.AddProduct(admin, &pb.AddProductRequest{ProductName: "e2e no category", CategoryId: 999999})
+	wantError(t, "AddProduct to unknown category", err, codes.InvalidArgument, pb.ErrorReason_CATEGORY_NOT_FOUND)
+	_, err = client.AddProduct(admin, &pb.AddProductRequest{
+		ProductName: "e2e negative",
+		CategoryId:  category.Id,
+		ListPrice:   &pb.Money{CurrencyCode: "INR", Units: -1},
+	})
+	wantError(t, "AddProduct with negative price", err, codes.InvalidArgument, pb.ErrorReason_INVALID_ARGUMENT)
+
+	// Both listings see the catalogue the same way.
+	filter := &pb.ProductFilter{CategoryId: category.Id, InStockOnly: true}
+	listed, err := client.GetProducts(ctx, &pb.GetProductsRequest{Filter: filter})
+	if err != nil {
+		t.Fatal(err)
+	}
+	viewed, err := client.ViewProducts(ctx, &pb.ViewProductsRequest{Filter: filter})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if listed.TotalCount != 1 || viewed.TotalCount != 1 || viewed.Products[0].Id != tab.Id {
+		t.Fatalf("in-stock tablets = %v and %v, want the tab s9 only", listed.Products, viewed.Products)
+	}
+	_, err = client.GetProducts(ctx, &pb.GetProductsRequest{PageToken: "not a token"})
+	wantError(t, "GetProducts with a bad page token", err, codes.InvalidArgument, pb.ErrorReason_INVALID_PAGE_TOKEN)
+
+	got, err := client.GetProduct(ctx, &pb.GetProductRequest{Id: tab.Id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Product.ListPrice.Units != 69999 || got.Product.CategoryName != "E2E Tablets" || got.Product.Version != 1 {
+		t.Errorf("GetProduct = %v", got.Product)
+	}
+	_, err = client.GetProduct(ctx, &pb.GetProductRequest{Id: "999999"})
+	wantError(t, "GetProduct of unknown id", err, codes.NotFound, pb.ErrorReason_PRODUCT_NOT_FOUND)
+	_, err = client.GetProduct(ctx, &pb.GetProductRequest{Id: "tab"})
+	wantError(t, "GetProduct of non-numeric id", err, codes.InvalidArgument, pb.ErrorReason_INVALID_PRODUCT_ID)
+
+	edited, err := client.EditProduct(admin, &pb.EditProductRequest{
+		Id:              tab.Id,
+		ListPrice:       &pb.Money{CurrencyCode: "INR", Units: 64999},
+		UpdateMask:      &fieldmaskpb.FieldMask{Paths: []string{"listPrice"}},
+		ExpectedVersion: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if edited.Version != 2 {
+		t.Errorf("version after edit = %d, want 2", edited.Version)
+	}
+	for _, tt := range []struct {
+		what   string
+		req    *pb.EditProductRequest
+		code   codes.Code
+		reason pb.ErrorReason
+	}{
+		{"non-numeric id", &pb.EditProductRequest{Id: "abc", ProductName: "x", UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"productName"}}, ExpectedVersion: 2},
+			codes.InvalidArgument, pb.ErrorReason_INVALID_ARGUMENT},
+		{"negative id", &pb.EditProductRequest{Id: "-3", ProductName: "x", UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"productName"}}, ExpectedVersion: 2},
+			codes.InvalidArgument, pb.ErrorReason_INVALID_ARGUMENT},
+		{"unknown id", &pb.EditProductRequest{Id: "999999", ProductName: "x", UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"productName"}}, ExpectedVersion: 1},
+			codes.NotFound, pb.ErrorReason_PRODUCT_NOT_FOUND},
+		{"stale version", &pb.EditProductRequest{Id: tab.Id, ProductName: "x", UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"productName"}}, ExpectedVersion: 1},
+			codes.Aborted, pb.ErrorReason_VERSION_MISMATCH},
+	} {
+		_, err := client.EditProduct(admin, tt.req)
+		wantError(t, "EditProduct with "+tt.what, err, tt.code, tt.reason)
+		if tt.reason == pb.ErrorReason_INVALID_ARGUMENT && fmt.Sprint(badFields(err)) != "[id]" {
+			t.Errorf("EditProduct with %s: bad fields %v, want [id]", tt.what, badFields(err))
+		}
+	}
+
+	// Deleted products leave the catalogue but can be restored.
+	if _, err := client.DeleteProduct(admin, &pb.DeleteProductRequest{Id: tab.Id}); err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.DeleteProduct(admin, &pb.DeleteProductRequest{Id: "x1"})
+	wantError(t, "DeleteProduct of non-numeric id", err, codes.InvalidArgument, pb.ErrorReason_INVALID_PRODUCT_ID)
+	_, err = client.GetProduct(ctx, &pb.GetProductRequest{Id: tab.Id})
+	wantError(t, "GetProduct of deleted product", err, codes.NotFound, pb.ErrorReason_PRODUCT_DISCONTINUED)
+	got, err = client.GetProduct(ctx, &pb.GetProductRequest{Id: tab.Id, IncludeDeleted: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Product.Discontinued || got.Product.DeletedAt == nil {
+		t.Errorf("deleted product = %v, want discontinued", got.Product)
+	}
+
+	deleted, err := client.ListDeletedProducts(admin, &pb.ListDeletedProductsRequest{Filter: &pb.ProductFilter{CategoryId: category.Id}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deleted.Products) != 1 || deleted.Products[0].Id != tab.Id {
+		t.Fatalf("deleted products = %v, want the tab s9", deleted.Products)
+	}
+	restored, err := client.RestoreProduct(admin, &pb.RestoreProductRequest{Id: tab.Id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored.Product.Discontinued || restored.Product.ListPrice.Units != 64999 {
+		t.Errorf("restored product = %v", restored.Product)
+	}
+	_, err = client.RestoreProduct(admin, &pb.RestoreProductRequest{Id: tab.Id})
+	wantError(t, "RestoreProduct of live product", err, codes.FailedPrecondition, pb.ErrorReason_PRODUCT_NOT_DELETED)
+	_, err = client.PurgeProduct(admin, &pb.PurgeProductRequest{Id: tab.Id})
+	wantError(t, "PurgeProduct of live product", err, codes.FailedPrecondition, pb.ErrorReason_PRODUCT_NOT_DELETED)
+
+	if _, err := client.DeleteProduct(admin, &pb.DeleteProductRequest{Id: tab.Id}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.PurgeProduct(admin, &pb.PurgeProductRequest{Id: tab.Id}); err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.GetProduct(ctx, &pb.GetProductRequest{Id: tab.Id, IncludeDeleted: true})
+	wantError(t, "GetProduct of purged product", err, codes.NotFound, pb.ErrorReason_PRODUCT_NOT_FOUND)
+	_, err = client.PurgeProduct(admin, &pb.PurgeProductRequest{Id: tab.Id})
+	wantError(t, "PurgeProduct twice", err, codes.NotFound, pb.ErrorReason_PRODUCT_NOT_FOUND)
+}
+
+func TestE2EStock(t *testing.T) {
+	client, _, gormDB := newTestClient(t)
+	service := as(t, auth.RoleService)
+
+	category := createE2ECategory(t, client, gormDB, "E2E Watches", 0)
+	watch := addE2EProduct(t, client, category.Id, "e2e watch", 24999, 10)
+	band := addE2EProduct(t, client, category.Id, "e2e band", 2999, 1)
+	watchID, bandID := productID(t, watch), productID(t, band)
+
+	res, err := client.ReduceStock(service, &pb.ReduceStockRequest{ProductId: watchID, Quantity: 3, Reference: "order-1"})
+	if err != nil || !res.Success {
+		t.Fatalf("ReduceStock = %v, %v", res, err)
+	}
+	_, err = client.ReduceStock(service, &pb.ReduceStockRequest{ProductId: watchID, Quantity: 8})
+	wantError(t, "ReduceStock beyond stock", err, codes.FailedPrecondition, pb.ErrorReason_INSUFFICIENT_STOCK)
+	_, err = client.ReduceStock(service, &pb.ReduceStockRequest{ProductId: watchID, Quantity: 0})
+	wantError(t, "ReduceStock of nothing", err, codes.InvalidArgument, pb.ErrorReason_INVALID_QUANTITY)
+	_, err = client.ReduceStock(service, &pb.ReduceStockRequest{ProductId: 999999, Quantity: 1})
+	wantError(t, "ReduceStock of unknown product", err, codes.NotFound, pb.ErrorReason_PRODUCT_NOT_FOUND)
+	_, err = client.ReduceStock(service, &pb.ReduceStockRequest{ProductId: -1, Quantity: 1})
+	wantError(t, "ReduceStock of negative product id", err, codes.InvalidArgument, pb.ErrorReason_INVALID_ARGUMENT)
+	_, err = client.RestoreStock(service, &pb.RestoreStockRequest{ProductId: watchID, VariantId: -1, Quantity: 1, Reason: pb.RestockReason_RESTOCK_REASON_RETURN})
+	wantError(t, "RestoreStock of negative variant id", err, codes.InvalidArgument, pb.ErrorReason_INVALID_ARGUMENT)
+	if fields := badFields(err); fmt.Sprint(fields) != "[variantId]" {
+		t.Errorf("RestoreStock of negative variant id: bad fields %v, want [variantId]", fields)
+	}
+
+	// A batch with one short line takes nothing.
+	batch, err := client.BatchReduceStock(service, &pb.BatchReduceStockRequest{Lines: []*pb.StockLine{
+		{ProductId: watchID, Quantity: 1},
+		{ProductId: bandID, Quantity: 2},
+	}})
+	wantError(t, "BatchReduceStock with a short line", err, codes.FailedPrecondition, pb.ErrorReason_BATCH_REJECTED)
+	if batch, err = client.BatchReduceStock(service, &pb.BatchReduceStockRequest{Lines: []*pb.StockLine{
+		{ProductId: watchID, Quantity: 1},
+		{ProductId: bandID, Quantity: 1},
+	}}); err != nil || !batch.Success {
+		t.Fatalf("BatchReduceStock = %v, %v", batch, err)
+	}
+	if got := productStock(t, client, watch.Id); got != 6 {
+		t.Fatalf("watch stock = %d, want 6", got)
+	}
+
+	// Reservations hold stock until committed or released.
+	reserve := func() int64 {
+		t.Helper()
+		res, err := client.ReserveStock(service, &pb.ReserveStockRequest{Lines: []*pb.StockLine{{ProductId: watchID, Quantity: 2}}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res.ReservationId
+	}
+	committed, released := reserve(), reserve()
+	if _, err := client.CommitReservation(service, &pb.CommitReservationRequest{ReservationId: committed}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.ReleaseReservation(service, &pb.ReleaseReservationRequest{ReservationId: released}); err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.ReleaseReservation(service, &pb.ReleaseReservationRequest{ReservationId: committed})
+	wantError(t, "ReleaseReservation of committed reservation", err, codes.FailedPrecondition, pb.ErrorReason_RESERVATION_COMMITTED)
+	_, err = client.CommitReservation(service, &pb.CommitReservationRequest{ReservationId: released})
+	wantError(t, "CommitReservation of released reservation", err, codes.FailedPrecondition, pb.ErrorReason_RESERVATION_RELEASED)
+	_, err = client.CommitReservation(service, &pb.CommitReservationRequest{ReservationId: 999999})
+	wantError(t, "CommitReservation of unknown reservation", err, codes.NotFound, pb.ErrorReason_RESERVATION_NOT_FOUND)
+	_, err = client.ReserveStock(service, &pb.ReserveStockRequest{Lines: []*pb.StockLine{{ProductId: bandID, Quantity: 1}}})
+	wantError(t, "ReserveStock beyond stock", err, codes.FailedPrecondition, pb.ErrorReason_BATCH_REJECTED)
+
+	if _, err := client.RestoreStock(service, &pb.RestoreStockRequest{
+		ProductId: watchID,
+		Quantity:  3,
+		Reason:    pb.RestockReason_RESTOCK_REASON_RETURN,
+		Reference: "order-1",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.RestoreStock(service, &pb.RestoreStockRequest{ProductId: 999999, Quantity: 1, Reason: pb.RestockReason_RESTOCK_REASON_RETURN})
+	wantError(t, "RestoreStock of unknown product", err, codes.NotFound, pb.ErrorReason_PRODUCT_NOT_FOUND)
+	if got := productStock(t, client, watch.Id); got != 7 {
+		t.Fatalf("watch stock = %d, want 7", got)
+	}
+
+	// The ledger adds up to the stock.
+	movements, err := client.ListStockMovements(as(t, auth.RoleAdmin), &pb.ListStockMovementsRequest{ProductId: watchID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var balance int32
+	for _, m := range movements.Movements {
+		balance += m.Delta
+	}
+	if balance != 7 || movements.Movements[0].Reason != pb.StockMovementReason_STOCK_MOVEMENT_REASON_RETURN ||
+		movements.Movements[0].Caller != "e2e-"+auth.RoleService {
+		t.Fatalf("movements = %v, want deltas adding up to 7 and the return first", movements.Movements)
+	}
+}
+
+func TestE2EConcurrentReduceStock(t *testing.T) {
+	client, _, gormDB := newTestClient(t)
+	service := as(t, auth.RoleService)
+
+	const stock, buyers = 15, 60
+	category := createE2ECategory(t, client, gormDB, "E2E Consoles", 0)
+	console := addE2EProduct(t, client, category.Id, "e2e console", 49999, stock)
+	id := productID(t, console)
+
+	var sold, short atomic.Int32
+	var wg sync.WaitGroup
+	for range buyers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := client.ReduceStock(service, &pb.ReduceStockRequest{ProductId: id, Quantity: 1})
+			switch {
+			case err == nil:
+				sold.Add(1)
+			case errorReason(err) == pb.ErrorReason_INSUFFICIENT_STOCK.String():
+				short.Add(1)
+			default:
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if sold.Load() != stock || short.Load() != buyers-stock {
+		t.Fatalf("sold %d and turned away %d, want %d and %d", sold.Load(), short.Load(), stock, buyers-stock)
+	}
+	if got := productStock(t, client, console.Id); got != 0 {
+		t.Fatalf("stock = %d, want 0", got)
+	}
+}
+
+func TestE2EVariantsOffersAndListings(t *testing.T) {
+	client, s, gormDB := newTestClient(t)
+	admin, service := as(t, auth.RoleAdmin), as(t, auth.RoleService)
+	ctx := context.Background()
+
+	category := createE2ECategory(t, client, gormDB, "E2E Laptops", 0)
+	laptop := addE2EProduct(t, client, category.Id, "e2e laptop", 99999, 0)
+	laptopID := productID(t, laptop)
+
+	added, err := client.AddVariant(admin, &pb.AddVariantRequest{
+		ProductId: laptopID,
+		Sku:       "E2E-LAPTOP-16",
+		Options:   []*pb.VariantOption{{Name: "memory", Value: "16 GB"}},
+		Price:     &pb.Money{CurrencyCode: "INR", Units: 99999},
+		Stock:     4,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	variant := added.Variant
+	_, err = client.AddVariant(admin, &pb.AddVariantRequest{
+		ProductId: laptopID,
+		Sku:       "E2E-LAPTOP-16",
+		Options:   []*pb.VariantOption{{Name: "memory", Value: "32 GB"}},
+		Price:     &pb.Money{CurrencyCode: "INR", Units: 119999},
+	})
+	wantError(t, "AddVariant with a taken SKU", err, codes.AlreadyExists, pb.ErrorReason_SKU_TAKEN)
+	_, err = client.AddVariant(admin, &pb.AddVariantRequest{ProductId: 999999, Sku: "E2E-NONE", Options: variant.Options, Price: variant.Price})
+	wantError(t, "AddVariant to unknown product", err, codes.NotFound, pb.ErrorReason_PRODUCT_NOT_FOUND)
+
+	if _, err := client.UpdateVariant(admin, &pb.UpdateVariantRequest{
+		Id:         variant.Id,
+		Stock:      6,
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"stock"}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.UpdateVariant(admin, &pb.UpdateVariantRequest{Id: 999999, Stock: 1, UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"stock"}}})
+	wantError(t, "UpdateVariant of unknown variant", err, codes.NotFound, pb.ErrorReason_VARIANT_NOT_FOUND)
+
+	// Products with variants sell per variant.
+	_, err = client.ReduceStock(service, &pb.ReduceStockRequest{ProductId: laptopID, Quantity: 1})
+	wantError(t, "ReduceStock without a variant", err, codes.FailedPrecondition, pb.ErrorReason_VARIANT_REQUIRED)
+	if _, err := client.ReduceStock(service, &pb.ReduceStockRequest{ProductId: laptopID, VariantId: variant.Id, Quantity: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if got := productStock(t, client, laptop.Id); got != 4 {
+		t.Fatalf("laptop stock = %d, want the variant's 4", got)
+	}
+
+	// Offers price the product while they run.
+	offer, err := client.CreateOffer(admin, &pb.CreateOfferRequest{
+		Name:       "E2E laptop days",
+		CategoryId: category.Id,
+		Kind:       pb.OfferKind_OFFER_KIND_PERCENT,
+		PercentOff: 10,
+		StartsAt:   timestamppb.New(time.Now().Add(-time.Hour)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.CreateOffer(admin, &pb.CreateOfferRequest{Name: "E2E nothing", Kind: pb.OfferKind_OFFER_KIND_PERCENT, PercentOff: 10})
+	wantError(t, "CreateOffer without a target", err, codes.InvalidArgument, pb.ErrorReason_INVALID_ARGUMENT)
+	offers, err := client.ListOffers(admin, &pb.ListOffersRequest{CategoryId: category.Id, RunningOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(offers.Offers) != 1 || offers.Offers[0].Id != offer.Offer.Id {
+		t.Fatalf("running offers = %v, want the laptop days", offers.Offers)
+	}
+	got, err := client.GetProduct(ctx, &pb.GetProductRequest{Id: laptop.Id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Product.Variants[0].EffectivePrice.Units != 89999 || got.Product.Offer.GetId() != offer.Offer.Id {
+		t.Errorf("laptop under offer = %v, want the variant at 89999", got.Product)
+	}
+	if _, err := client.DeleteOffer(admin, &pb.DeleteOfferRequest{Id: offer.Offer.Id}); err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.DeleteOffer(admin, &pb.DeleteOfferRequest{Id: offer.Offer.Id})
+	wantError(t, "DeleteOffer twice", err, codes.NotFound, pb.ErrorReason_OFFER_NOT_FOUND)
+
+	// Featured and popular listings.
+	if _, err := client.SetProductFeatured(admin, &pb.SetProductFeaturedRequest{Id: laptop.Id, Featured: true, Rank: 1}); err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.SetProductFeatured(admin, &pb.SetProductFeaturedRequest{Id: "999999", Featured: true})
+	wantError(t, "SetProductFeatured of unknown product", err, codes.NotFound, pb.ErrorReason_PRODUCT_NOT_FOUND)
+	filter := &pb.ProductFilter{CategoryId: category.Id}
+	featured, err := client.ListFeaturedProducts(ctx, &pb.ListFeaturedProductsRequest{Filter: filter})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(featured.Products) != 1 || !featured.Products[0].Featured {
+		t.Fatalf("featured = %v, want the laptop", featured.Products)
+	}
+	if err := s.RefreshPopularity(ctx); err != nil {
+		t.Fatal(err)
+	}
+	popular, err := client.ListPopularProducts(ctx, &pb.ListPopularProductsRequest{Filter: filter})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(popular.Products) != 1 || popular.Products[0].RecentSales != 2 {
+		t.Fatalf("popular = %v, want the laptop with 2 sales", popular.Products)
+	}
+
+	if _, err := client.DeleteVariant(admin, &pb.DeleteVariantRequest{Id: variant.Id}); err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.DeleteVariant(admin, &pb.DeleteVariantRequest{Id: variant.Id})
+	wantError(t, "DeleteVariant twice", err, codes.NotFound, pb.ErrorReason_VARIANT_NOT_FOUND)
+}
@@ -0,0 +1,142 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/Manuelmastro/mobilehub-product/v3/pkg/db"
+	"github.com/Manuelmastro/mobilehub-product/v3/pkg/pb"
+	"github.com/Manuelmastro/mobilehub-product/v3/pkg/validation"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/protoadapt"
+)
+
+// errorDomain is the ErrorInfo domain of every error this service returns.
+const errorDomain = "product.mobilehub"
+
+// statusError builds a gRPC status error with an ErrorInfo detail, plus any
+// extra details such as BadRequest or PreconditionFailure.
+func statusError(code codes.Code, reason pb.ErrorReason, msg string, metadata map[string]string, details ...protoadapt.MessageV1) error {
+	st := status.New(code, msg)
+	info := &errdetails.ErrorInfo{
+		Reason:   reason.String(),
+		Domain:   errorDomain,
+		Metadata: metadata,
+	}
+	withDetails, err := st.WithDetails(append([]protoadapt.MessageV1{info}, details...)...)
+	if err != nil {
+		return st.Err()
+	}
+	return withDetails.Err()
+}
+
+func invalidArgument(reason pb.ErrorReason, msg string) error {
+	return statusError(codes.InvalidArgument, reason, msg, nil)
+}
+
+func productNotFound(productID any) error {
+	return statusError(codes.NotFound, pb.ErrorReason_PRODUCT_NOT_FOUND, "product not found",
+		map[string]string{"product_id": fmt.Sprint(productID)})
+}
+
+func productDiscontinued(productID any) error {
+	return statusError(codes.NotFound, pb.ErrorReason_PRODUCT_DISCONTINUED, "product is discontinued",
+		map[string]string{"product_id": fmt.Sprint(productID)})
+}
+
+// internalError hides a database failure behind Internal, or Aborted when
+// the database gave up on the transaction and the call is safe to retry.
+func internalError(msg string, err error) error {
+	if db.Retryable(err) {
+		return statusError(codes.Aborted, pb.ErrorReason_CONCURRENT_MODIFICATION,
+			"concurrent modification, retry the request", nil)
+	}
+
+	log.Printf("%s: %v", msg, err)
+	return statusError(codes.Internal, pb.ErrorReason_INTERNAL, msg, nil)
+}
+
+// stockError maps the errors of the stock helpers to statuses.
+func stockError(err error, productID any, msg string) error {
+	switch {
+	case errors.Is(err, errProductDiscontinued):
+		return productDiscontinued(productID)
+	case errors.Is(err, errProductNotFound):
+		return productNotFound(productID)
+	case errors.Is(err, errVariantNotFound):
+		return statusError(codes.NotFound, pb.ErrorReason_VARIANT_NOT_FOUND, "variant not found",
+			map[string]string{"product_id": fmt.Sprint(productID)})
+	case errors.Is(err, errVariantRequired):
+		return statusError(codes.FailedPrecondition, pb.ErrorReason_VARIANT_REQUIRED, "product has variants, name the variant",
+			map[string]string{"product_id": fmt.Sprint(productID)})
+	case errors.Is(err, errInsufficientStock):
+		return statusError(codes.FailedPrecondition, pb.ErrorReason_INSUFFICIENT_STOCK, "insufficient stock",
+			map[string]string{"product_id": fmt.Sprint(productID)})
+	case errors.Is(err, errInvalidQuantity):
+		return invalidArgument(pb.ErrorReason_INVALID_QUANTITY, "quantity must be positive")
+	case errors.Is(err, errIdempotencyKeyTooLong):
+		return invalidArgument(pb.ErrorReason_INVALID_IDEMPOTENCY_KEY, "idempotency key too long")
+	case errors.Is(err, errIdempotencyKeyMismatch):
+		return invalidArgument(pb.ErrorReason_IDEMPOTENCY_KEY_REUSED, "idempotency key already used for a different request")
+	default:
+		return internalError(msg, err)
+	}
+}
+
+// validationError turns the violations found by the validation package into
+// InvalidArgument with one BadRequest field violation each.
+func validationError(err error) error {
+	var violations validation.Violations
+	if !errors.As(err, &violations) {
+		return invalidArgument(pb.ErrorReason_INVALID_ARGUMENT, err.Error())
+	}
+
+	badRequest := &errdetails.BadRequest{}
+	for _, v := range violations {
+		badRequest.FieldViolations = append(badRequest.FieldViolations, &errdetails.BadRequest_FieldViolation{
+			Field:       v.Field,
+			Description: v.Description,
+		})
+	}
+	return statusError(codes.InvalidArgument, pb.ErrorReason_INVALID_ARGUMENT, violations.Error(), nil, badRequest)
+}
+
+// batchRejected reports the failed lines of a batch as precondition
+// violations, one per line, in request order. The response the batch would
+// have had goes along as a detail, so clients read the status of every line
+// there too.
+func batchRejected(lines []*pb.StockLine, lineErrs []error, msg string, response protoadapt.MessageV1) error {
+	failure := &errdetails.PreconditionFailure{}
+	for i, err := range lineErrs {
+		if err == nil {
+			continue
+		}
+		reason := pb.ErrorReason_INSUFFICIENT_STOCK
+		switch {
+		case errors.Is(err, errProductDiscontinued):
+			reason = pb.ErrorReason_PRODUCT_DISCONTINUED
+		case errors.Is(err, errProductNotFound):
+			reason = pb.ErrorReason_PRODUCT_NOT_FOUND
+		case errors.Is(err, errVariantNotFound):
+			reason = pb.ErrorReason_VARIANT_NOT_FOUND
+		case errors.Is(err, errVariantRequired):
+			reason = pb.ErrorReason_VARIANT_REQUIRED
+		}
+		subject := fmt.Sprintf("product %d", lines[i].ProductId)
+		if lines[i].VariantId != 0 {
+			subject += fmt.Sprintf(" variant %d", lines[i].VariantId)
+		}
+		failure.Violations = append(failure.Violations, &errdetails.PreconditionFailure_Violation{
+			Type:        reason.String(),
+			Subject:     fmt.Sprintf("lines[%d]", i),
+			Description: fmt.Sprintf("%s: %v", subject, err),
+		})
+	}
+
+	return statusError(codes.FailedPrecondition, pb.ErrorReason_BATCH_REJECTED,
+		fmt.Sprintf("%s, %d of %d lines failed", msg, len(failure.Violations), len(lines)),
+		nil, failure, response)
+}
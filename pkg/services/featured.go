@@ -0,0 +1,104 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"github.com/Manuelmastro/mobilehub-product/v3/pkg/pb"
+	"github.com/Manuelmastro/mobilehub-product/v3/pkg/repository"
+	"github.com/Manuelmastro/mobilehub-product/v3/pkg/validation"
+)
+
+const defaultPopularityWindow = 7 * 24 * time.Hour
+
+// SetProductFeatured puts a product on the featured list at a rank, or takes
+// it off. It is merchandising rather than an edit of the product, so the
+// product's version is left alone.
+func (s *ProductServiceServer) SetProductFeatured(ctx context.Context, req *pb.SetProductFeaturedRequest) (*pb.SetProductFeaturedResponse, error) {
+	productID, err := parseProductID(req.Id)
+	if err != nil {
+		return nil, err
+	}
+	if err := validation.SetProductFeatured(req); err != nil {
+		return nil, validationError(err)
+	}
+
+	var rank *int32
+	if req.Featured {
+		rank = &req.Rank
+	}
+	if err := s.Products.SetFeaturedRank(ctx, productID, rank); err != nil {
+		return nil, stockError(err, productID, "failed to update product")
+	}
+
+	product, err := s.findProduct(ctx, productID, false)
+	if err != nil {
+		return nil, err
+	}
+	prices, err := s.pricing(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.SetProductFeaturedResponse{Product: productToProto(product, prices)}, nil
+}
+
+func (s *ProductServiceServer) ListFeaturedProducts(ctx context.Context, req *pb.ListFeaturedProductsRequest) (*pb.ListFeaturedProductsResponse, error) {
+	page, err := s.listProducts(ctx, productQuery{
+		PageSize:  req.PageSize,
+		PageToken: req.PageToken,
+		Filter:    req.Filter,
+		Listing:   repository.ListFeatured,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := s.productsToProto(ctx, page.Products)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.ListFeaturedProductsResponse{
+		Products:      response,
+		NextPageToken: page.NextPageToken,
+		TotalCount:    page.TotalCount,
+	}, nil
+}
+
+func (s *ProductServiceServer) ListPopularProducts(ctx context.Context, req *pb.ListPopularProductsRequest) (*pb.ListPopularProductsResponse, error) {
+	page, err := s.listProducts(ctx, productQuery{
+		PageSize:  req.PageSize,
+		PageToken: req.PageToken,
+		Filter:    req.Filter,
+		Listing:   repository.ListPopular,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := s.productsToProto(ctx, page.Products)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.ListPopularProductsResponse{
+		Products:      response,
+		NextPageToken: page.NextPageToken,
+		TotalCount:    page.TotalCount,
+	}, nil
+}
+
+func (s *ProductServiceServer) popularityWindow() time.Duration {
+	if s.PopularityWindow <= 0 {
+		return defaultPopularityWindow
+	}
+	return s.PopularityWindow
+}
+
+// RefreshPopularity recomputes the recent sales of every live product from
+// the sale movements of the popularity window in the inventory ledger. It is
+// run periodically by the popularity job.
+func (s *ProductServiceServer) RefreshPopularity(ctx context.Context) error {
+	return s.Products.RefreshRecentSales(ctx, time.Now().Add(-s.popularityWindow()))
+}
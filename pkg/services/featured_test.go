@@ -0,0 +1,85 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Manuelmastro/mobilehub-product/v3/pkg/models"
+	"github.com/Manuelmastro/mobilehub-product/v3/pkg/pb"
+)
+
+func TestFeaturedAndPopularProducts(t *testing.T) {
+	s, gormDB := newTestServer(t)
+	ctx := context.Background()
+
+	products := []models.Product{
+		{ProductName: "carousel test a", Stock: 10},
+		{ProductName: "carousel test b", Stock: 10},
+		{ProductName: "carousel test c", Stock: 10},
+	}
+	if err := gormDB.Create(&products).Error; err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { gormDB.Unscoped().Delete(&products) })
+	a, b, c := products[0], products[1], products[2]
+	filter := &pb.ProductFilter{NameContains: "carousel test"}
+
+	names := func(products []*pb.Product) []string {
+		var names []string
+		for _, p := range products {
+			names = append(names, p.ProductName)
+		}
+		return names
+	}
+
+	for _, f := range []struct {
+		product models.Product
+		rank    int32
+	}{{c, 2}, {a, 1}, {b, 3}} {
+		_, err := s.SetProductFeatured(ctx, &pb.SetProductFeaturedRequest{Id: fmt.Sprint(f.product.ID), Featured: true, Rank: f.rank})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := s.SetProductFeatured(ctx, &pb.SetProductFeaturedRequest{Id: fmt.Sprint(b.ID)}); err != nil {
+		t.Fatal(err)
+	}
+	featured, err := s.ListFeaturedProducts(ctx, &pb.ListFeaturedProductsRequest{Filter: filter})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := names(featured.Products); fmt.Sprint(got) != "[carousel test a carousel test c]" {
+		t.Fatalf("featured = %v, want a then c", got)
+	}
+
+	// Popularity follows recent sales, older sales fall out of the window.
+	sell := func(p models.Product, quantity int32) {
+		t.Helper()
+		if _, err := s.ReduceStock(ctx, &pb.ReduceStockRequest{ProductId: int64(p.ID), Quantity: quantity}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sell(b, 3)
+	sell(c, 1)
+	old := models.StockMovement{ProductID: c.ID, Delta: -5, Reason: models.MovementSale,
+		CreatedAt: time.Now().Add(-2 * s.popularityWindow())}
+	if err := gormDB.Create(&old).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.RefreshPopularity(ctx); err != nil {
+		t.Fatal(err)
+	}
+	popular, err := s.ListPopularProducts(ctx, &pb.ListPopularProductsRequest{Filter: filter})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := names(popular.Products); fmt.Sprint(got) != "[carousel test b carousel test c]" {
+		t.Fatalf("popular = %v, want b then c", got)
+	}
+	if popular.Products[0].RecentSales != 3 || popular.Products[1].RecentSales != 1 {
+		t.Errorf("recent sales = %d, %d, want 3, 1", popular.Products[0].RecentSales, popular.Products[1].RecentSales)
+	}
+}
@@ -0,0 +1,135 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/Manuelmastro/mobilehub-product/v3/pkg/models"
+	"github.com/Manuelmastro/mobilehub-product/v3/pkg/repository"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	defaultIdempotencyKeyTTL = 24 * time.Hour
+	maxIdempotencyKeyLength  = 128
+)
+
+var (
+	errIdempotencyKeyTooLong  = errors.New("idempotency key too long")
+	errIdempotencyKeyMismatch = errors.New("idempotency key was already used for a different request")
+)
+
+// idempotent runs fn in a transaction and stores its response under key in
+// the same transaction, so the stock change and the record of it commit or
+// roll back together. A repeated key within the retention window returns the
+// stored response without running fn. An empty key just runs fn. Everything
+// runs on ctx, a call cancelled halfway rolls back.
+func idempotent[T proto.Message](ctx context.Context, s *ProductServiceServer, method, key string, req proto.Message, fn func(tx repository.InventoryRepository) (T, error)) (T, error) {
+	var zero T
+
+	if key == "" {
+		var resp T
+		err := s.Inventory.Atomically(ctx, func(tx repository.InventoryRepository) error {
+			var err error
+			resp, err = fn(tx)
+			return err
+		})
+		return resp, err
+	}
+	if len(key) > maxIdempotencyKeyLength {
+		return zero, errIdempotencyKeyTooLong
+	}
+
+	hash, err := requestHash(req)
+	if err != nil {
+		return zero, err
+	}
+	cutoff := time.Now().Add(-s.idempotencyKeyTTL())
+
+	if resp, found, err := replay[T](ctx, s.Inventory, method, key, hash, cutoff); err != nil || found {
+		return resp, err
+	}
+
+	var resp T
+	err = s.Inventory.Atomically(ctx, func(tx repository.InventoryRepository) error {
+		var err error
+		if resp, err = fn(tx); err != nil {
+			return err
+		}
+		raw, err := proto.Marshal(resp)
+		if err != nil {
+			return err
+		}
+		return tx.SaveIdempotencyKey(ctx, models.IdempotencyKey{
+			Method:      method,
+			Key:         key,
+			RequestHash: hash,
+			Response:    raw,
+		}, cutoff)
+	})
+	if errors.Is(err, repository.ErrIdempotencyKeyTaken) {
+		// Another call with the same key committed first, answer like it did.
+		if resp, found, err := replay[T](ctx, s.Inventory, method, key, hash, cutoff); err != nil || found {
+			return resp, err
+		}
+	}
+	if err != nil {
+		return zero, err
+	}
+	return resp, nil
+}
+
+// replay loads the stored response for key, if there is one.
+func replay[T proto.Message](ctx context.Context, inventory repository.InventoryRepository, method, key, hash string, cutoff time.Time) (T, bool, error) {
+	var zero T
+
+	record, err := inventory.IdempotencyKey(ctx, method, key, cutoff)
+	if errors.Is(err, repository.ErrIdempotencyKeyUnknown) {
+		return zero, false, nil
+	}
+	if err != nil {
+		return zero, false, err
+	}
+	if record.RequestHash != hash {
+		return zero, false, errIdempotencyKeyMismatch
+	}
+
+	resp := zero.ProtoReflect().New().Interface().(T)
+	if err := proto.Unmarshal(record.Response, resp); err != nil {
+		return zero, false, err
+	}
+	return resp, true, nil
+}
+
+// requestHash fingerprints a request without its idempotency key, so that a
+// key reused for a different request can be told apart from a retry.
+func requestHash(req proto.Message) (string, error) {
+	clone := proto.Clone(req)
+	m := clone.ProtoReflect()
+	if fd := m.Descriptor().Fields().ByName("idempotency_key"); fd != nil {
+		m.Clear(fd)
+	}
+
+	raw, err := proto.MarshalOptions{Deterministic: true}.Marshal(clone)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func (s *ProductServiceServer) idempotencyKeyTTL() time.Duration {
+	if s.IdempotencyKeyTTL <= 0 {
+		return defaultIdempotencyKeyTTL
+	}
+	return s.IdempotencyKeyTTL
+}
+
+// DeleteExpiredIdempotencyKeys removes keys past the retention window. It is
+// run periodically by the idempotency key cleanup job.
+func (s *ProductServiceServer) DeleteExpiredIdempotencyKeys(ctx context.Context) error {
+	return s.Inventory.DeleteIdempotencyKeys(ctx, time.Now().Add(-s.idempotencyKeyTTL()))
+}
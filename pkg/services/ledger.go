@@ -0,0 +1,112 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Manuelmastro/mobilehub-product/v3/pkg/auth"
+	"github.com/Manuelmastro/mobilehub-product/v3/pkg/models"
+	"github.com/Manuelmastro/mobilehub-product/v3/pkg/pb"
+	"github.com/Manuelmastro/mobilehub-product/v3/pkg/repository"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+var movementReasons = map[string]pb.StockMovementReason{
+	models.MovementInitial:            pb.StockMovementReason_STOCK_MOVEMENT_REASON_INITIAL,
+	models.MovementSale:               pb.StockMovementReason_STOCK_MOVEMENT_REASON_SALE,
+	models.MovementReservation:        pb.StockMovementReason_STOCK_MOVEMENT_REASON_RESERVATION,
+	models.MovementReservationRelease: pb.StockMovementReason_STOCK_MOVEMENT_REASON_RESERVATION_RELEASE,
+	models.MovementReservationExpiry:  pb.StockMovementReason_STOCK_MOVEMENT_REASON_RESERVATION_EXPIRY,
+	models.MovementCancellation:       pb.StockMovementReason_STOCK_MOVEMENT_REASON_CANCELLATION,
+	models.MovementReturn:             pb.StockMovementReason_STOCK_MOVEMENT_REASON_RETURN,
+	models.MovementCorrection:         pb.StockMovementReason_STOCK_MOVEMENT_REASON_CORRECTION,
+	models.MovementAdminEdit:          pb.StockMovementReason_STOCK_MOVEMENT_REASON_ADMIN_EDIT,
+}
+
+var restockReasons = map[pb.RestockReason]string{
+	pb.RestockReason_RESTOCK_REASON_CANCELLATION: models.MovementCancellation,
+	pb.RestockReason_RESTOCK_REASON_RETURN:       models.MovementReturn,
+	pb.RestockReason_RESTOCK_REASON_CORRECTION:   models.MovementCorrection,
+}
+
+// callerFromContext identifies who made a stock change, for the ledger: the
+// token subject, or the peer address for calls that carried no token.
+func callerFromContext(ctx context.Context) string {
+	if claims, ok := auth.FromContext(ctx); ok && claims.Subject != "" {
+		return claims.Subject
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		return p.Addr.String()
+	}
+	return ""
+}
+
+// reservationReference is the ledger reference of a reservation's movements,
+// the caller's own reference when it gave one.
+func reservationReference(r models.Reservation) string {
+	if r.Reference != "" {
+		return r.Reference
+	}
+	return fmt.Sprintf("reservation/%d", r.ID)
+}
+
+func (s *ProductServiceServer) ListStockMovements(ctx context.Context, req *pb.ListStockMovementsRequest) (*pb.ListStockMovementsResponse, error) {
+	if req.ProductId <= 0 {
+		return nil, statusError(codes.InvalidArgument, pb.ErrorReason_INVALID_PRODUCT_ID, "invalid product ID",
+			map[string]string{"product_id": fmt.Sprint(req.ProductId)})
+	}
+
+	limit := int(req.PageSize)
+	if limit <= 0 {
+		limit = defaultPageSize
+	}
+	if limit > maxPageSize {
+		limit = maxPageSize
+	}
+	offset, err := decodePageToken(req.PageToken)
+	if err != nil {
+		return nil, err
+	}
+
+	q := repository.MovementQuery{
+		ProductID: uint(req.ProductId),
+		VariantID: uint(req.VariantId),
+		Offset:    offset,
+		Limit:     limit + 1, // one extra row tells whether there is a next page without a COUNT
+	}
+	if req.StartTime != nil {
+		start := req.StartTime.AsTime()
+		q.Start = &start
+	}
+	if req.EndTime != nil {
+		end := req.EndTime.AsTime()
+		q.End = &end
+	}
+	movements, err := s.Inventory.Movements(ctx, q)
+	if err != nil {
+		return nil, internalError("failed to fetch stock movements", err)
+	}
+
+	response := &pb.ListStockMovementsResponse{}
+	if len(movements) > limit {
+		movements = movements[:limit]
+		response.NextPageToken = encodePageToken(offset + limit)
+	}
+	for _, m := range movements {
+		response.Movements = append(response.Movements, &pb.StockMovement{
+			Id:        int64(m.ID),
+			ProductId: int64(m.ProductID),
+			VariantId: int64(m.VariantID),
+			Delta:     m.Delta,
+			Balance:   m.Balance,
+			Reason:    movementReasons[m.Reason],
+			Reference: m.Reference,
+			Caller:    m.Caller,
+			CreatedAt: timestamppb.New(m.CreatedAt),
+		})
+	}
+
+	return response, nil
+}
@@ -0,0 +1,58 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Manuelmastro/mobilehub-product/v3/pkg/models"
+	"github.com/Manuelmastro/mobilehub-product/v3/pkg/pb"
+)
+
+func TestStockMovementsRecordEveryChange(t *testing.T) {
+	s, gormDB := newTestServer(t)
+
+	product := models.Product{ProductName: "ledger test", Stock: 10}
+	if err := gormDB.Create(&product).Error; err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { gormDB.Unscoped().Delete(&product) })
+
+	ctx := context.Background()
+	if _, err := s.ReduceStock(ctx, &pb.ReduceStockRequest{
+		ProductId: int64(product.ID),
+		Quantity:  4,
+		Reference: "order-1",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.RestoreStock(ctx, &pb.RestoreStockRequest{
+		ProductId: int64(product.ID),
+		Quantity:  1,
+		Reason:    pb.RestockReason_RESTOCK_REASON_CANCELLATION,
+		Reference: "order-1",
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := s.ListStockMovements(ctx, &pb.ListStockMovementsRequest{ProductId: int64(product.ID)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Movements) != 2 {
+		t.Fatalf("got %d movements, want 2", len(res.Movements))
+	}
+
+	want := []struct {
+		delta, balance int32
+		reason         pb.StockMovementReason
+	}{
+		{1, 7, pb.StockMovementReason_STOCK_MOVEMENT_REASON_CANCELLATION},
+		{-4, 6, pb.StockMovementReason_STOCK_MOVEMENT_REASON_SALE},
+	}
+	for i, w := range want {
+		m := res.Movements[i]
+		if m.Delta != w.delta || m.Balance != w.balance || m.Reason != w.reason || m.Reference != "order-1" {
+			t.Errorf("movement %d = %+v, want delta %d balance %d reason %v", i, m, w.delta, w.balance, w.reason)
+		}
+	}
+}
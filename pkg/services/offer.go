@@ -0,0 +1,256 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Manuelmastro/mobilehub-product/v3/pkg/models"
+	"github.com/Manuelmastro/mobilehub-product/v3/pkg/money"
+	"github.com/Manuelmastro/mobilehub-product/v3/pkg/pb"
+	"github.com/Manuelmastro/mobilehub-product/v3/pkg/repository"
+	"github.com/Manuelmastro/mobilehub-product/v3/pkg/validation"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+var offerKinds = map[pb.OfferKind]string{
+	pb.OfferKind_OFFER_KIND_PERCENT: models.OfferPercent,
+	pb.OfferKind_OFFER_KIND_AMOUNT:  models.OfferAmount,
+}
+
+func offerToProto(o models.Offer) *pb.Offer {
+	offer := &pb.Offer{
+		Id:         int64(o.ID),
+		Name:       o.Name,
+		PercentOff: o.PercentOff,
+		StartsAt:   timestamppb.New(o.StartsAt),
+	}
+	if o.ProductID != nil {
+		offer.ProductId = int64(*o.ProductID)
+	}
+	if o.CategoryID != nil {
+		offer.CategoryId = int64(*o.CategoryID)
+	}
+	switch o.Kind {
+	case models.OfferPercent:
+		offer.Kind = pb.OfferKind_OFFER_KIND_PERCENT
+	case models.OfferAmount:
+		offer.Kind = pb.OfferKind_OFFER_KIND_AMOUNT
+		offer.AmountOff = money.ToProto(o.AmountOffMinor, o.Currency)
+	}
+	if o.EndsAt != nil {
+		offer.EndsAt = timestamppb.New(*o.EndsAt)
+	}
+	return offer
+}
+
+// pricing holds the offers running at one moment, indexed by what they
+// discount, so a page of products is priced with a single query.
+type pricing struct {
+	byProduct  map[uint][]models.Offer
+	byCategory map[uint][]models.Offer
+	parents    map[uint]uint // category ID to parent ID
+}
+
+func loadPricing(ctx context.Context, offers repository.OfferRepository, categories repository.CategoryRepository, now time.Time) (pricing, error) {
+	p := pricing{
+		byProduct:  map[uint][]models.Offer{},
+		byCategory: map[uint][]models.Offer{},
+		parents:    map[uint]uint{},
+	}
+
+	running, err := offers.Running(ctx, now)
+	if err != nil {
+		return p, err
+	}
+	for _, o := range running {
+		switch {
+		case o.ProductID != nil:
+			p.byProduct[*o.ProductID] = append(p.byProduct[*o.ProductID], o)
+		case o.CategoryID != nil:
+			p.byCategory[*o.CategoryID] = append(p.byCategory[*o.CategoryID], o)
+		}
+	}
+	if len(p.byCategory) == 0 {
+		return p, nil
+	}
+
+	p.parents, err = categories.Parents(ctx)
+	return p, err
+}
+
+// pricing loads the offers running now.
+func (s *ProductServiceServer) pricing(ctx context.Context) (pricing, error) {
+	p, err := loadPricing(ctx, s.Offers, s.Categories, time.Now())
+	if err != nil {
+		return p, internalError("failed to fetch offers", err)
+	}
+	return p, nil
+}
+
+// offersFor returns the running offers of a product: its own and those of
+// its category and every ancestor of the category.
+func (p pricing) offersFor(productID uint, categoryID *uint) []models.Offer {
+	offers := append([]models.Offer(nil), p.byProduct[productID]...)
+	if categoryID == nil {
+		return offers
+	}
+	seen := map[uint]bool{}
+	for id, ok := *categoryID, true; ok && !seen[id]; id, ok = p.parents[id] {
+		seen[id] = true
+		offers = append(offers, p.byCategory[id]...)
+	}
+	return offers
+}
+
+// bestPrice applies the offer giving the lowest price to minor. Offers do
+// not stack. Without an offer that lowers the price it returns minor and nil.
+func bestPrice(offers []models.Offer, minor int64, currency string) (int64, *models.Offer) {
+	price, best := minor, (*models.Offer)(nil)
+	for i := range offers {
+		if discounted := discount(offers[i], minor, currency); discounted < price {
+			price, best = discounted, &offers[i]
+		}
+	}
+	return price, best
+}
+
+// discount returns minor less offer o. Percentages round to the nearest minor
+// unit and amounts only apply to prices in their currency. Prices never go
+// below zero.
+func discount(o models.Offer, minor int64, currency string) int64 {
+	var off int64
+	switch o.Kind {
+	case models.OfferPercent:
+		off = (minor*int64(o.PercentOff) + 50) / 100
+	case models.OfferAmount:
+		if o.Currency == currency {
+			off = o.AmountOffMinor
+		}
+	}
+	if off >= minor {
+		return 0
+	}
+	return minor - off
+}
+
+// variantOffers returns the running offers of the product a variant belongs to.
+func (s *ProductServiceServer) variantOffers(ctx context.Context, productID uint) ([]models.Offer, error) {
+	prices, err := s.pricing(ctx)
+	if err != nil {
+		return nil, err
+	}
+	product, err := s.findProduct(ctx, productID, true)
+	if err != nil {
+		return nil, err
+	}
+	return prices.offersFor(product.ID, product.CategoryID), nil
+}
+
+func (s *ProductServiceServer) CreateOffer(ctx context.Context, req *pb.CreateOfferRequest) (*pb.CreateOfferResponse, error) {
+	if err := validation.CreateOffer(req); err != nil {
+		return nil, validationError(err)
+	}
+
+	offer := models.Offer{
+		Name:       req.Name,
+		Kind:       offerKinds[req.Kind],
+		PercentOff: req.PercentOff,
+		StartsAt:   time.Now(),
+	}
+	if req.AmountOff != nil {
+		amount, currency, err := money.FromProto(req.AmountOff, s.currency())
+		if err != nil {
+			return nil, invalidArgument(pb.ErrorReason_INVALID_PRICE, "invalid amount_off")
+		}
+		offer.AmountOffMinor, offer.Currency = amount, currency
+	}
+	if req.StartsAt != nil {
+		offer.StartsAt = req.StartsAt.AsTime()
+	}
+	if req.EndsAt != nil {
+		ends := req.EndsAt.AsTime()
+		offer.EndsAt = &ends
+	}
+
+	if req.ProductId > 0 {
+		productID := uint(req.ProductId)
+		offer.ProductID = &productID
+	} else {
+		categoryID := uint(req.CategoryId)
+		offer.CategoryID = &categoryID
+	}
+	if err := s.Offers.Create(ctx, &offer); err != nil {
+		return nil, offerError(err, req, "failed to create offer")
+	}
+
+	return &pb.CreateOfferResponse{Offer: offerToProto(offer)}, nil
+}
+
+func (s *ProductServiceServer) ListOffers(ctx context.Context, req *pb.ListOffersRequest) (*pb.ListOffersResponse, error) {
+	limit := int(req.PageSize)
+	if limit <= 0 {
+		limit = defaultPageSize
+	}
+	if limit > maxPageSize {
+		limit = maxPageSize
+	}
+	offset, err := decodePageToken(req.PageToken)
+	if err != nil {
+		return nil, err
+	}
+
+	q := repository.OfferQuery{
+		ProductID:  uint(req.ProductId),
+		CategoryID: uint(req.CategoryId),
+		Offset:     offset,
+		Limit:      limit + 1, // one extra row tells whether there is a next page without counting
+	}
+	if req.RunningOnly {
+		now := time.Now()
+		q.RunningAt = &now
+	}
+	offers, err := s.Offers.List(ctx, q)
+	if err != nil {
+		return nil, internalError("failed to fetch offers", err)
+	}
+
+	response := &pb.ListOffersResponse{}
+	if len(offers) > limit {
+		offers = offers[:limit]
+		response.NextPageToken = encodePageToken(offset + limit)
+	}
+	for _, o := range offers {
+		response.Offers = append(response.Offers, offerToProto(o))
+	}
+	return response, nil
+}
+
+// DeleteOffer ends an offer for good, whether or not it started.
+func (s *ProductServiceServer) DeleteOffer(ctx context.Context, req *pb.DeleteOfferRequest) (*pb.DeleteOfferResponse, error) {
+	err := s.Offers.Delete(ctx, uint(req.Id))
+	if errors.Is(err, repository.ErrOfferNotFound) {
+		return nil, statusError(codes.NotFound, pb.ErrorReason_OFFER_NOT_FOUND, "offer not found",
+			map[string]string{"offer_id": fmt.Sprint(req.Id)})
+	}
+	if err != nil {
+		return nil, internalError("failed to delete offer", err)
+	}
+
+	return &pb.DeleteOfferResponse{
+		Status:  true,
+		Message: "Offer deleted successfully",
+	}, nil
+}
+
+// offerError maps the errors of CreateOffer to statuses.
+func offerError(err error, req *pb.CreateOfferRequest, msg string) error {
+	switch {
+	case errors.Is(err, errCategoryNotFound):
+		return categoryError(err, req.CategoryId, "", msg)
+	default:
+		return stockError(err, req.ProductId, msg)
+	}
+}
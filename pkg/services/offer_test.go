@@ -0,0 +1,104 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Manuelmastro/mobilehub-product/v3/pkg/models"
+	"github.com/Manuelmastro/mobilehub-product/v3/pkg/pb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestDiscount(t *testing.T) {
+	tests := []struct {
+		name  string
+		offer models.Offer
+		minor int64
+		want  int64
+	}{
+		{"percent", models.Offer{Kind: models.OfferPercent, PercentOff: 10}, 7999900, 7199910},
+		{"percent rounds to the paisa", models.Offer{Kind: models.OfferPercent, PercentOff: 15}, 999, 849},
+		{"free", models.Offer{Kind: models.OfferPercent, PercentOff: 100}, 999, 0},
+		{"amount", models.Offer{Kind: models.OfferAmount, AmountOffMinor: 50000, Currency: "INR"}, 7999900, 7949900},
+		{"amount over price", models.Offer{Kind: models.OfferAmount, AmountOffMinor: 50000, Currency: "INR"}, 100, 0},
+		{"amount in another currency", models.Offer{Kind: models.OfferAmount, AmountOffMinor: 500, Currency: "USD"}, 7999900, 7999900},
+	}
+	for _, tt := range tests {
+		if got := discount(tt.offer, tt.minor, "INR"); got != tt.want {
+			t.Errorf("%s: discount = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestOffersSetEffectivePrice(t *testing.T) {
+	s, gormDB := newTestServer(t)
+	ctx := context.Background()
+
+	phones := createTestCategory(t, gormDB, "Phones")
+	android := createTestCategory(t, gormDB, "Android")
+	gormDB.Model(&android).Update("parent_id", phones.ID)
+
+	product := models.Product{ProductName: "offer test phone", CategoryID: &android.ID, PriceMinor: 2000000, Currency: "INR"}
+	if err := gormDB.Create(&product).Error; err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		gormDB.Where("product_id = ? OR category_id IN ?", product.ID, []uint{phones.ID, android.ID}).Delete(&models.Offer{})
+		gormDB.Unscoped().Delete(&product)
+	})
+
+	effective := func() *pb.Product {
+		t.Helper()
+		res, err := s.GetProduct(ctx, &pb.GetProductRequest{Id: fmt.Sprint(product.ID)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res.Product
+	}
+	if p := effective(); p.EffectivePrice.Units != 20000 || p.Offer != nil {
+		t.Fatalf("without offers: effective %v, offer %v, want the list price", p.EffectivePrice, p.Offer)
+	}
+
+	create := func(req *pb.CreateOfferRequest) *pb.Offer {
+		t.Helper()
+		res, err := s.CreateOffer(ctx, req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res.Offer
+	}
+
+	// A category offer covers products of its subcategories.
+	create(&pb.CreateOfferRequest{Name: "Phone week", CategoryId: int64(phones.ID),
+		Kind: pb.OfferKind_OFFER_KIND_PERCENT, PercentOff: 10})
+	// Offers that have not started do nothing yet.
+	create(&pb.CreateOfferRequest{Name: "Next week", ProductId: int64(product.ID),
+		Kind: pb.OfferKind_OFFER_KIND_PERCENT, PercentOff: 50, StartsAt: timestamppb.New(time.Now().Add(24 * time.Hour))})
+	if p := effective(); p.EffectivePrice.Units != 18000 || p.Offer.GetName() != "Phone week" {
+		t.Fatalf("category offer: effective %v, offer %v, want 18000 from Phone week", p.EffectivePrice, p.Offer)
+	}
+
+	// Offers do not stack, the best one wins.
+	best := create(&pb.CreateOfferRequest{Name: "Flat 2500", ProductId: int64(product.ID),
+		Kind: pb.OfferKind_OFFER_KIND_AMOUNT, AmountOff: &pb.Money{CurrencyCode: "INR", Units: 2500}})
+	if p := effective(); p.EffectivePrice.Units != 17500 || p.ListPrice.Units != 20000 || p.Offer.GetId() != best.Id {
+		t.Fatalf("best offer: list %v, effective %v, offer %v, want 17500 from Flat 2500", p.ListPrice, p.EffectivePrice, p.Offer)
+	}
+
+	running, err := s.ListOffers(ctx, &pb.ListOffersRequest{ProductId: int64(product.ID), RunningOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(running.Offers) != 1 || running.Offers[0].Id != best.Id {
+		t.Fatalf("running product offers = %v, want Flat 2500 only", running.Offers)
+	}
+
+	if _, err := s.DeleteOffer(ctx, &pb.DeleteOfferRequest{Id: best.Id}); err != nil {
+		t.Fatal(err)
+	}
+	if p := effective(); p.EffectivePrice.Units != 18000 {
+		t.Fatalf("after deleting the best offer: effective %v, want 18000", p.EffectivePrice)
+	}
+}
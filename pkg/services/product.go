@@ -5,167 +5,335 @@ import (
 	"errors"
 	"fmt"
 	"strconv"
+	"time"
 
-	"github.com/Manuelmastro/mobilehub-product/v3/pkg/db"
 	"github.com/Manuelmastro/mobilehub-product/v3/pkg/models"
+	"github.com/Manuelmastro/mobilehub-product/v3/pkg/money"
 	"github.com/Manuelmastro/mobilehub-product/v3/pkg/pb"
-	"gorm.io/gorm"
+	"github.com/Manuelmastro/mobilehub-product/v3/pkg/repository"
+	"github.com/Manuelmastro/mobilehub-product/v3/pkg/validation"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 type ProductServiceServer struct {
 	pb.UnimplementedProductServiceServer
-	H db.Handler
+
+	// The handlers only reach storage through these repositories.
+	Products   repository.ProductRepository
+	Variants   repository.VariantRepository
+	Categories repository.CategoryRepository
+	Offers     repository.OfferRepository
+	Inventory  repository.InventoryRepository
+
+	// ReservationTTL is how long ReserveStock holds stock when the caller
+	// does not ask for a TTL.
+	ReservationTTL time.Duration
+
+	// IdempotencyKeyTTL is how long idempotency keys are honoured.
+	IdempotencyKeyTTL time.Duration
+
+	// Currency is used for prices sent without a currency code.
+	Currency string
+
+	// DeletedProductRetention is how long soft-deleted products can still be
+	// restored before the purge job removes them. Zero keeps them forever.
+	DeletedProductRetention time.Duration
+
+	// PopularityWindow is how far back sales count towards the popular
+	// ranking.
+	PopularityWindow time.Duration
 }
 
-func (s *ProductServiceServer) GetProducts(ctx context.Context, req *pb.GetProductsRequest) (*pb.GetProductsResponse, error) {
-	var products []models.Product
-	if err := s.H.DB.Where("deleted_at IS NULL").Find(&products).Error; err != nil {
-		return nil, errors.New("failed to fetch products")
+var errVersionMismatch = repository.ErrVersionMismatch
+
+// productToProto converts a product, priced with the offers in prices.
+func productToProto(product models.Product, prices pricing) *pb.Product {
+	offers := prices.offersFor(product.ID, product.CategoryID)
+	effective, offer := bestPrice(offers, product.PriceMinor, product.Currency)
+
+	response := &pb.Product{
+		Id:          fmt.Sprint(product.ID),
+		ProductName: product.ProductName,
+		Description: product.Description,
+		ImageUrl:    product.ImageUrl,
+		Price:       money.ToFloat(product.PriceMinor),
+		Stock:       product.Stock,
+		ListPrice:   money.ToProto(product.PriceMinor, product.Currency),
+		Version:     product.Version,
+
+		EffectivePrice: money.ToProto(effective, product.Currency),
 	}
+	if offer != nil {
+		response.Offer = offerToProto(*offer)
+	}
+	if product.CategoryID != nil {
+		response.CategoryId = int64(*product.CategoryID)
+	}
+	if len(product.Variants) > 0 {
+		response.Stock = 0
+		for _, v := range product.Variants {
+			response.Variants = append(response.Variants, variantToProto(v, offers))
+			response.Stock += v.Stock
+		}
+		response.Options = productOptions(product.Variants)
+	}
+	if product.Category != nil {
+		response.CategoryName = product.Category.Name
+	}
+	if product.FeaturedRank != nil {
+		response.Featured = true
+		response.FeaturedRank = *product.FeaturedRank
+	}
+	response.RecentSales = product.RecentSales
+	if product.DeletedAt.Valid {
+		response.DeletedAt = timestamppb.New(product.DeletedAt.Time)
+		response.Discontinued = true
+	}
+	return response
+}
+
+// productsToProto converts a page of products, priced with the offers
+// running now.
+func (s *ProductServiceServer) productsToProto(ctx context.Context, products []models.Product) ([]*pb.Product, error) {
+	prices, err := s.pricing(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	var response []*pb.Product
 	for _, product := range products {
-		response = append(response, &pb.Product{
-			Id:           fmt.Sprint(product.ID),
-			ProductName:  product.ProductName,
-			Description:  product.Description,
-			ImageUrl:     product.ImageUrl,
-			Price:        float32(product.Price),
-			Stock:        product.Stock,
-			CategoryName: product.CategoryName,
-		})
+		response = append(response, productToProto(product, prices))
+	}
+	return response, nil
+}
+
+// parseProductID parses the string IDs used by the product RPCs.
+func parseProductID(id string) (uint, error) {
+	productID, err := strconv.ParseUint(id, 10, 0)
+	if err != nil || productID == 0 {
+		return 0, statusError(codes.InvalidArgument, pb.ErrorReason_INVALID_PRODUCT_ID, "invalid product ID",
+			map[string]string{"product_id": id})
 	}
+	return uint(productID), nil
+}
 
-	return &pb.GetProductsResponse{Products: response}, nil
+// findProduct loads a product, a deleted one only with includeDeleted. A
+// deleted product is reported as discontinued, so callers can tell it from an
+// unknown ID.
+func (s *ProductServiceServer) findProduct(ctx context.Context, productID uint, includeDeleted bool) (models.Product, error) {
+	product, err := s.Products.Get(ctx, productID, includeDeleted)
+	if err != nil {
+		return product, stockError(err, productID, "failed to fetch product")
+	}
+	return product, nil
+}
+
+func (s *ProductServiceServer) currency() string {
+	if s.Currency == "" {
+		return money.DefaultCurrency
+	}
+	return s.Currency
+}
+
+// requestPrice resolves the price of an add or edit request, preferring the
+// exact listPrice over the deprecated float field.
+func (s *ProductServiceServer) requestPrice(listPrice *pb.Money, legacy float32) (int64, string, error) {
+	if listPrice != nil {
+		return money.FromProto(listPrice, s.currency())
+	}
+	minor, err := money.FromFloat(legacy)
+	return minor, s.currency(), err
+}
+
+func (s *ProductServiceServer) GetProducts(ctx context.Context, req *pb.GetProductsRequest) (*pb.GetProductsResponse, error) {
+	page, err := s.listProducts(ctx, productQuery{
+		PageSize:  req.PageSize,
+		PageToken: req.PageToken,
+		Filter:    req.Filter,
+		Sort:      req.Sort,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := s.productsToProto(ctx, page.Products)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.GetProductsResponse{
+		Products:      response,
+		NextPageToken: page.NextPageToken,
+		TotalCount:    page.TotalCount,
+	}, nil
 }
 
 func (s *ProductServiceServer) AddProduct(ctx context.Context, req *pb.AddProductRequest) (*pb.AddProductResponse, error) {
-	// Authorization check for admin role
-	// role, ok := ctx.Value("role").(string)
-	// if !ok || role != "admin" {
-	// 	return nil, errors.New("unauthorized: only admin can add products")
-	// }
+	if err := validation.AddProduct(req); err != nil {
+		return nil, validationError(err)
+	}
+
+	price, currency, err := s.requestPrice(req.ListPrice, req.Price)
+	if err != nil {
+		return nil, invalidArgument(pb.ErrorReason_INVALID_PRICE, "invalid price")
+	}
+
+	categoryID, err := s.resolveCategory(ctx, req.CategoryId, req.CategoryName)
+	if err != nil {
+		return nil, err
+	}
 
 	product := models.Product{
-		ProductName:  req.ProductName,
-		Description:  req.Description,
-		ImageUrl:     req.ImageUrl,
-		Price:        float64(req.Price),
-		Stock:        req.Stock,
-		CategoryName: req.CategoryName,
+		ProductName: req.ProductName,
+		Description: req.Description,
+		ImageUrl:    req.ImageUrl,
+		PriceMinor:  price,
+		Currency:    currency,
+		Stock:       req.Stock,
+		CategoryID:  &categoryID,
 	}
 
-	if err := s.H.DB.Create(&product).Error; err != nil {
-		return nil, errors.New("failed to add product")
+	if err := s.Products.Create(ctx, &product, callerFromContext(ctx)); err != nil {
+		return nil, internalError("failed to add product", err)
 	}
 
 	return &pb.AddProductResponse{
+		Status:  true,
 		Message: "Product added successfully",
 	}, nil
 }
 
 func (s *ProductServiceServer) EditProduct(ctx context.Context, req *pb.EditProductRequest) (*pb.EditProductResponse, error) {
-	// Authorization check for admin role
-	// role, ok := ctx.Value("role").(string)
-	// if !ok || role != "admin" {
-	// 	return nil, errors.New("unauthorized: only admin can edit products")
-	// }
+	if err := validation.EditProduct(req); err != nil {
+		return nil, validationError(err)
+	}
 
-	productID, err := strconv.Atoi(req.Id)
+	productID, err := parseProductID(req.Id)
 	if err != nil {
-		return nil, errors.New("invalid product ID")
+		return nil, err
 	}
 
-	var product models.Product
-	if err := s.H.DB.First(&product, productID).Error; err != nil {
-		return nil, errors.New("product not found")
+	change := repository.ProductChange{Caller: callerFromContext(ctx)}
+	for _, path := range validation.EditMask(req) {
+		switch path {
+		case validation.PathProductName:
+			change.Name = &req.ProductName
+		case validation.PathDescription:
+			change.Description = &req.Description
+		case validation.PathImageURL:
+			change.ImageURL = &req.ImageUrl
+		case validation.PathListPrice:
+			price, currency, err := s.requestPrice(req.ListPrice, req.Price)
+			if err != nil {
+				return nil, invalidArgument(pb.ErrorReason_INVALID_PRICE, "invalid price")
+			}
+			change.PriceMinor, change.Currency = &price, currency
+		case validation.PathCategory:
+			categoryID, err := s.resolveCategory(ctx, req.CategoryId, req.CategoryName)
+			if err != nil {
+				return nil, err
+			}
+			change.CategoryID = &categoryID
+		case validation.PathStock:
+			change.Stock = &req.Stock
+		}
 	}
 
-	product.ProductName = req.ProductName
-	product.Description = req.Description
-	product.ImageUrl = req.ImageUrl
-	product.Price = float64(req.Price)
-	product.Stock = req.Stock
-	product.CategoryName = req.CategoryName
-
-	if err := s.H.DB.Save(&product).Error; err != nil {
-		return nil, errors.New("failed to update product")
+	version, err := s.Products.Update(ctx, productID, req.ExpectedVersion, change)
+	if errors.Is(err, errVersionMismatch) {
+		// Either the product is gone or someone else edited it first.
+		product, err := s.findProduct(ctx, productID, false)
+		if err != nil {
+			return nil, err
+		}
+		return nil, statusError(codes.Aborted, pb.ErrorReason_VERSION_MISMATCH,
+			"product changed since it was read, reload and retry",
+			map[string]string{
+				"product_id":       req.Id,
+				"expected_version": fmt.Sprint(req.ExpectedVersion),
+				"current_version":  fmt.Sprint(product.Version),
+			})
+	}
+	if errors.Is(err, errConcurrentStockChange) {
+		return nil, statusError(codes.Aborted, pb.ErrorReason_CONCURRENT_MODIFICATION,
+			"stock changed while editing, retry the request", map[string]string{"product_id": req.Id})
+	}
+	if errors.Is(err, errVariantRequired) {
+		return nil, stockError(err, req.Id, "")
+	}
+	if err != nil {
+		return nil, internalError("failed to update product", err)
 	}
 
 	return &pb.EditProductResponse{
+		Status:  true,
 		Message: "Product updated successfully",
+		Version: version,
 	}, nil
 }
 
 func (s *ProductServiceServer) DeleteProduct(ctx context.Context, req *pb.DeleteProductRequest) (*pb.DeleteProductResponse, error) {
-	// Authorization check for admin role
-	// role, ok := ctx.Value("role").(string)
-	// if !ok || role != "admin" {
-	// 	return nil, errors.New("unauthorized: only admin can delete products")
-	// }
-
-	productID, err := strconv.Atoi(req.Id)
+	productID, err := parseProductID(req.Id)
 	if err != nil {
-		return nil, errors.New("invalid product ID")
+		return nil, err
 	}
 
-	var product models.Product
-	if err := s.H.DB.First(&product, productID).Error; err != nil {
-		return nil, errors.New("product not found")
-	}
-
-	if err := s.H.DB.Delete(&product).Error; err != nil {
-		return nil, errors.New("failed to delete product")
+	if err := s.Products.Delete(ctx, productID); err != nil {
+		return nil, stockError(err, productID, "failed to delete product")
 	}
 
 	return &pb.DeleteProductResponse{
+		Status:  true,
 		Message: "Product deleted successfully",
 	}, nil
 }
 
 func (s *ProductServiceServer) ViewProducts(ctx context.Context, req *pb.ViewProductsRequest) (*pb.ViewProductsResponse, error) {
 	// No authentication needed for viewing products
-	var products []models.Product
-	if err := s.H.DB.Where("deleted_at IS NULL").Find(&products).Error; err != nil {
-		return nil, errors.New("failed to fetch products")
+	page, err := s.listProducts(ctx, productQuery{
+		PageSize:  req.PageSize,
+		PageToken: req.PageToken,
+		Filter:    req.Filter,
+		Sort:      req.Sort,
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	var response []*pb.Product
-	for _, product := range products {
-		response = append(response, &pb.Product{
-			Id:           fmt.Sprint(product.ID),
-			ProductName:  product.ProductName,
-			Description:  product.Description,
-			ImageUrl:     product.ImageUrl,
-			Price:        float32(product.Price),
-			Stock:        product.Stock,
-			CategoryName: product.CategoryName,
-		})
+	response, err := s.productsToProto(ctx, page.Products)
+	if err != nil {
+		return nil, err
 	}
 
-	return &pb.ViewProductsResponse{Products: response}, nil
+	return &pb.ViewProductsResponse{
+		Products:      response,
+		NextPageToken: page.NextPageToken,
+		TotalCount:    page.TotalCount,
+	}, nil
 }
 
 ///
 
 func (s *ProductServiceServer) GetProduct(ctx context.Context, req *pb.GetProductRequest) (*pb.GetProductResponse, error) {
-	var product models.Product
+	productID, err := parseProductID(req.Id)
+	if err != nil {
+		return nil, err
+	}
 
-	// Fetch product by ID
-	if err := s.H.DB.Where("id = ?", req.Id).First(&product).Error; err != nil {
-		return nil, errors.New("product not found")
+	// Fetch product by ID, deleted ones only when asked for
+	product, err := s.findProduct(ctx, productID, req.IncludeDeleted)
+	if err != nil {
+		return nil, err
+	}
+	prices, err := s.pricing(ctx)
+	if err != nil {
+		return nil, err
 	}
 
 	// Map product to response
 	response := &pb.GetProductResponse{
-		Product: &pb.Product{
-			Id:           fmt.Sprint(product.ID),
-			ProductName:  product.ProductName,
-			Description:  product.Description,
-			ImageUrl:     product.ImageUrl,
-			Price:        float32(product.Price),
-			Stock:        int32(product.Stock),
-			CategoryName: product.CategoryName,
-		},
+		Product: productToProto(product, prices),
 	}
 
 	return response, nil
@@ -174,45 +342,99 @@ func (s *ProductServiceServer) GetProduct(ctx context.Context, req *pb.GetProduc
 ////////////////////////abcdefg///
 
 func (s *ProductServiceServer) ReduceStock(ctx context.Context, req *pb.ReduceStockRequest) (*pb.ReduceStockResponse, error) {
-	var product models.Product // Replace `Product` with your actual product struct
+	if err := validation.ReduceStock(req); err != nil {
+		return nil, validationError(err)
+	}
 
-	// Fetch product details directly from the database
-	err := s.H.DB.Where("id = ?", req.ProductId).First(&product).Error // Assuming GORM is used
-	if err != nil {
-		if err == gorm.ErrRecordNotFound {
+	response, err := idempotent(ctx, s, pb.ProductService_ReduceStock_FullMethodName, req.IdempotencyKey, req,
+		func(tx repository.InventoryRepository) (*pb.ReduceStockResponse, error) {
+			item := repository.StockItem{ProductID: uint(req.ProductId), VariantID: uint(req.VariantId)}
+			err := reduceStock(ctx, tx, item, req.Quantity, repository.Movement{
+				Reason:    models.MovementSale,
+				Reference: req.Reference,
+				Caller:    callerFromContext(ctx),
+			})
+			if err != nil {
+				return nil, err
+			}
 			return &pb.ReduceStockResponse{
-				Success: false,
-				Message: "Product not found",
+				Success: true,
+				Message: "Stock updated successfully",
 			}, nil
-		}
-		return &pb.ReduceStockResponse{
-			Success: false,
-			Message: "Error fetching product details",
-		}, nil
+		})
+	if err != nil {
+		return nil, stockError(err, req.ProductId, "failed to update stock")
+	}
+
+	return response, nil
+}
+
+// RestoreStock is the compensation for ReduceStock, used when an order is
+// cancelled or returned.
+func (s *ProductServiceServer) RestoreStock(ctx context.Context, req *pb.RestoreStockRequest) (*pb.RestoreStockResponse, error) {
+	if err := validation.RestoreStock(req); err != nil {
+		return nil, validationError(err)
+	}
+	if _, ok := restockReasons[req.Reason]; !ok {
+		return nil, invalidArgument(pb.ErrorReason_INVALID_ARGUMENT, "restock reason is required")
 	}
 
-	// Check if enough stock is available
-	if product.Stock < req.Quantity {
-		return &pb.ReduceStockResponse{
-			Success: false,
-			Message: "Insufficient stock",
-		}, nil
+	response, err := idempotent(ctx, s, pb.ProductService_RestoreStock_FullMethodName, req.IdempotencyKey, req,
+		func(tx repository.InventoryRepository) (*pb.RestoreStockResponse, error) {
+			item := repository.StockItem{ProductID: uint(req.ProductId), VariantID: uint(req.VariantId)}
+			err := restoreStock(ctx, tx, item, req.Quantity, repository.Movement{
+				Reason:    restockReasons[req.Reason],
+				Reference: req.Reference,
+				Caller:    callerFromContext(ctx),
+			})
+			if err != nil {
+				return nil, err
+			}
+			return &pb.RestoreStockResponse{
+				Success: true,
+				Message: "Stock restored successfully",
+			}, nil
+		})
+	if err != nil {
+		return nil, stockError(err, req.ProductId, "failed to restore stock")
 	}
 
-	// Reduce stock
-	product.Stock -= req.Quantity
+	return response, nil
+}
+
+func (s *ProductServiceServer) BatchReduceStock(ctx context.Context, req *pb.BatchReduceStockRequest) (*pb.BatchReduceStockResponse, error) {
+	if err := validation.StockLines(req.Lines); err != nil {
+		return nil, validationError(err)
+	}
 
-	// Save updated product details to the database
-	err = s.H.DB.Save(&product).Error // Save updated stock back to DB
+	var lineErrs []error
+	response, err := idempotent(ctx, s, pb.ProductService_BatchReduceStock_FullMethodName, req.IdempotencyKey, req,
+		func(tx repository.InventoryRepository) (*pb.BatchReduceStockResponse, error) {
+			var err error
+			lineErrs, err = reduceStockLines(ctx, tx, req.Lines, repository.Movement{
+				Reason:    models.MovementSale,
+				Reference: req.Reference,
+				Caller:    callerFromContext(ctx),
+			})
+			if err != nil {
+				return nil, err
+			}
+
+			return &pb.BatchReduceStockResponse{
+				Success: true,
+				Message: "Stock updated successfully",
+				Results: stockLineResults(req.Lines, lineErrs),
+			}, nil
+		})
+	if errors.Is(err, errBatchRejected) {
+		return nil, batchRejected(req.Lines, lineErrs, "no stock reduced", &pb.BatchReduceStockResponse{
+			Message: "No stock reduced",
+			Results: stockLineResults(req.Lines, lineErrs),
+		})
+	}
 	if err != nil {
-		return &pb.ReduceStockResponse{
-			Success: false,
-			Message: "Failed to update stock",
-		}, nil
+		return nil, stockError(err, nil, "failed to update stock")
 	}
 
-	return &pb.ReduceStockResponse{
-		Success: true,
-		Message: "Stock updated successfully",
-	}, nil
+	return response, nil
 }
@@ -0,0 +1,279 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Manuelmastro/mobilehub-product/v3/pkg/models"
+	"github.com/Manuelmastro/mobilehub-product/v3/pkg/pb"
+	"github.com/Manuelmastro/mobilehub-product/v3/pkg/repository"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+)
+
+func TestEditProductPartialUpdate(t *testing.T) {
+	s, gormDB := newTestServer(t)
+	category := createTestCategory(t, gormDB, "Smartphones")
+
+	product := models.Product{
+		ProductName: "Pixel 9",
+		CategoryID:  &category.ID,
+		PriceMinor:  7999999,
+		Currency:    "INR",
+		Stock:       10,
+	}
+	if err := gormDB.Create(&product).Error; err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { gormDB.Unscoped().Delete(&product) })
+
+	id := fmt.Sprint(product.ID)
+	ctx := context.Background()
+
+	// Only the price is sent, everything else must survive.
+	res, err := s.EditProduct(ctx, &pb.EditProductRequest{
+		Id:              id,
+		ListPrice:       &pb.Money{CurrencyCode: "INR", Units: 74999},
+		Stock:           0,
+		UpdateMask:      &fieldmaskpb.FieldMask{Paths: []string{"listPrice"}},
+		ExpectedVersion: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Version != 2 {
+		t.Errorf("version after edit = %d, want 2", res.Version)
+	}
+
+	var after models.Product
+	if err := gormDB.First(&after, product.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if after.PriceMinor != 7499900 || after.ProductName != "Pixel 9" || *after.CategoryID != category.ID || after.Stock != 10 {
+		t.Errorf("after price edit: %+v", after)
+	}
+
+	// Stock moves only when masked in, and the change lands in the ledger.
+	if _, err := s.EditProduct(ctx, &pb.EditProductRequest{
+		Id:              id,
+		Stock:           4,
+		UpdateMask:      &fieldmaskpb.FieldMask{Paths: []string{"stock"}},
+		ExpectedVersion: 2,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := gormDB.First(&after, product.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if after.Stock != 4 {
+		t.Errorf("stock = %d, want 4", after.Stock)
+	}
+
+	var movement models.StockMovement
+	if err := gormDB.Where("product_id = ?", product.ID).Last(&movement).Error; err != nil {
+		t.Fatal(err)
+	}
+	if movement.Delta != -6 || movement.Balance != 4 || movement.Reason != models.MovementAdminEdit {
+		t.Errorf("movement = %+v, want delta -6 balance 4", movement)
+	}
+}
+
+func TestEditProductVersionMismatch(t *testing.T) {
+	s, gormDB := newTestServer(t)
+
+	product := models.Product{ProductName: "Galaxy S24"}
+	if err := gormDB.Create(&product).Error; err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { gormDB.Unscoped().Delete(&product) })
+
+	edit := func(name string) error {
+		_, err := s.EditProduct(context.Background(), &pb.EditProductRequest{
+			Id:              fmt.Sprint(product.ID),
+			ProductName:     name,
+			UpdateMask:      &fieldmaskpb.FieldMask{Paths: []string{"productName"}},
+			ExpectedVersion: 1,
+		})
+		return err
+	}
+
+	// Both admins opened version 1, the second save must not overwrite the first.
+	if err := edit("Galaxy S24 Ultra"); err != nil {
+		t.Fatal(err)
+	}
+	if err := edit("Galaxy S24 FE"); status.Code(err) != codes.Aborted {
+		t.Fatalf("second edit: got %v, want Aborted", err)
+	}
+
+	var after models.Product
+	if err := gormDB.First(&after, product.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if after.ProductName != "Galaxy S24 Ultra" || after.Version != 2 {
+		t.Errorf("after edits: name %q version %d", after.ProductName, after.Version)
+	}
+}
+
+// newMemoryServer serves the product handlers from memory, they need no
+// database.
+func newMemoryServer(t *testing.T) (*ProductServiceServer, *repository.MemoryProducts) {
+	t.Helper()
+	products := repository.NewMemoryProducts()
+	return &ProductServiceServer{
+		Products:   products,
+		Variants:   products.Variants(),
+		Categories: products.Categories(),
+		Offers:     products.Offers(),
+		Inventory:  products.Inventory(),
+	}, products
+}
+
+func TestProductListingInMemory(t *testing.T) {
+	s, products := newMemoryServer(t)
+	ctx := context.Background()
+
+	phones := products.AddCategory(models.Category{Name: "Phones", Slug: "phones"})
+	smartphones := products.AddCategory(models.Category{Name: "Smart Phones", Slug: "smart-phones", ParentID: &phones.ID})
+	products.AddCategory(models.Category{Name: "Laptops", Slug: "laptops"})
+
+	add := func(name, category string, units int64, stock int32) {
+		t.Helper()
+		if _, err := s.AddProduct(ctx, &pb.AddProductRequest{
+			ProductName:  name,
+			CategoryName: category,
+			ListPrice:    &pb.Money{CurrencyCode: "INR", Units: units},
+			Stock:        stock,
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	add("Pixel 9", "smart phones", 79999, 3)
+	add("Nokia 105", "Phones", 1499, 0)
+	add("Galaxy S24", "Smart Phones", 74999, 5)
+	add("ThinkPad X1", "laptops", 149999, 2)
+
+	// The parent category covers its subcategories.
+	res, err := s.GetProducts(ctx, &pb.GetProductsRequest{
+		Filter:   &pb.ProductFilter{CategoryId: int64(phones.ID), InStockOnly: true},
+		Sort:     pb.ProductSort_PRODUCT_SORT_PRICE_ASC,
+		PageSize: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.TotalCount != 2 || len(res.Products) != 1 || res.Products[0].ProductName != "Galaxy S24" || res.NextPageToken == "" {
+		t.Fatalf("first page = %v, want Galaxy S24 of 2 in-stock phones", res)
+	}
+	if res.Products[0].CategoryName != smartphones.Name {
+		t.Errorf("category name = %q, want %q", res.Products[0].CategoryName, smartphones.Name)
+	}
+
+	res, err = s.GetProducts(ctx, &pb.GetProductsRequest{
+		Filter:    &pb.ProductFilter{CategoryId: int64(phones.ID), InStockOnly: true},
+		Sort:      pb.ProductSort_PRODUCT_SORT_PRICE_ASC,
+		PageSize:  1,
+		PageToken: res.NextPageToken,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Products) != 1 || res.Products[0].ProductName != "Pixel 9" || res.NextPageToken != "" {
+		t.Fatalf("second page = %v, want Pixel 9 and no next page", res)
+	}
+
+	// Offers of a category price every product below it.
+	products.AddOffer(models.Offer{
+		Name:       "Phone week",
+		CategoryID: &phones.ID,
+		Kind:       models.OfferPercent,
+		PercentOff: 10,
+		StartsAt:   time.Now().Add(-time.Hour),
+	})
+	res, err = s.GetProducts(ctx, &pb.GetProductsRequest{Filter: &pb.ProductFilter{NameContains: "pixel"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Products) != 1 || res.Products[0].EffectivePrice.Units != 71999 {
+		t.Fatalf("products = %v, want Pixel 9 at 71999", res.Products)
+	}
+}
+
+func TestEditProductInMemory(t *testing.T) {
+	s, products := newMemoryServer(t)
+	ctx := context.Background()
+
+	products.AddCategory(models.Category{Name: "Smartphones", Slug: "smartphones"})
+	if _, err := s.AddProduct(ctx, &pb.AddProductRequest{
+		ProductName:  "Pixel 9",
+		CategoryName: "Smartphones",
+		ListPrice:    &pb.Money{CurrencyCode: "INR", Units: 79999},
+		Stock:        10,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	listed, err := s.GetProducts(ctx, &pb.GetProductsRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := listed.Products[0].Id
+
+	res, err := s.EditProduct(ctx, &pb.EditProductRequest{
+		Id:              id,
+		ProductName:     "Pixel 9 Pro",
+		Stock:           4,
+		UpdateMask:      &fieldmaskpb.FieldMask{Paths: []string{"productName", "stock"}},
+		ExpectedVersion: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Version != 2 {
+		t.Errorf("version after edit = %d, want 2", res.Version)
+	}
+
+	// A second edit from the same version loses.
+	_, err = s.EditProduct(ctx, &pb.EditProductRequest{
+		Id:              id,
+		ProductName:     "Pixel 9a",
+		UpdateMask:      &fieldmaskpb.FieldMask{Paths: []string{"productName"}},
+		ExpectedVersion: 1,
+	})
+	if reason := errorReason(err); status.Code(err) != codes.Aborted || reason != pb.ErrorReason_VERSION_MISMATCH.String() {
+		t.Fatalf("stale edit: got %v, want Aborted VERSION_MISMATCH", err)
+	}
+
+	got, err := s.GetProduct(ctx, &pb.GetProductRequest{Id: id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Product.ProductName != "Pixel 9 Pro" || got.Product.Stock != 4 || got.Product.ListPrice.Units != 79999 {
+		t.Errorf("after edits: %v", got.Product)
+	}
+
+	productID, _ := parseProductID(id)
+	movements := products.Movements(productID)
+	if len(movements) != 2 || movements[0].Reason != models.MovementInitial ||
+		movements[1].Delta != -6 || movements[1].Balance != 4 || movements[1].Reason != models.MovementAdminEdit {
+		t.Errorf("movements = %+v, want initial 10 and admin edit -6", movements)
+	}
+
+	// Deleted products cannot be edited, and are told apart from unknown ones.
+	if _, err := s.DeleteProduct(ctx, &pb.DeleteProductRequest{Id: id}); err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.EditProduct(ctx, &pb.EditProductRequest{
+		Id:              id,
+		ProductName:     "Pixel 9 Pro XL",
+		UpdateMask:      &fieldmaskpb.FieldMask{Paths: []string{"productName"}},
+		ExpectedVersion: 2,
+	})
+	if reason := errorReason(err); reason != pb.ErrorReason_PRODUCT_DISCONTINUED.String() {
+		t.Fatalf("edit of deleted product: got %v, want PRODUCT_DISCONTINUED", err)
+	}
+	if _, err := s.DeleteProduct(ctx, &pb.DeleteProductRequest{Id: "999"}); status.Code(err) != codes.NotFound {
+		t.Fatalf("delete of unknown product: got %v, want NotFound", err)
+	}
+}
@@ -0,0 +1,144 @@
+package services
+
+import (
+	"context"
+	"encoding/base64"
+	"strconv"
+
+	"github.com/Manuelmastro/mobilehub-product/v3/pkg/models"
+	"github.com/Manuelmastro/mobilehub-product/v3/pkg/money"
+	"github.com/Manuelmastro/mobilehub-product/v3/pkg/pb"
+	"github.com/Manuelmastro/mobilehub-product/v3/pkg/repository"
+)
+
+var errInvalidPageToken = invalidArgument(pb.ErrorReason_INVALID_PAGE_TOKEN, "invalid page token")
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// productQuery is the common shape of the product listing requests.
+type productQuery struct {
+	PageSize  int32
+	PageToken string
+	Filter    *pb.ProductFilter
+	Sort      pb.ProductSort // only used by repository.ListCatalogue
+
+	Listing repository.Listing
+}
+
+var productSorts = map[pb.ProductSort]repository.Sort{
+	pb.ProductSort_PRODUCT_SORT_PRICE_ASC:  repository.SortPriceAsc,
+	pb.ProductSort_PRODUCT_SORT_PRICE_DESC: repository.SortPriceDesc,
+	pb.ProductSort_PRODUCT_SORT_NAME_ASC:   repository.SortNameAsc,
+	pb.ProductSort_PRODUCT_SORT_NAME_DESC:  repository.SortNameDesc,
+}
+
+// productPage is one page of a product listing.
+type productPage struct {
+	Products      []models.Product
+	NextPageToken string
+	TotalCount    int64
+}
+
+func (s *ProductServiceServer) listProducts(ctx context.Context, q productQuery) (*productPage, error) {
+	limit := int(q.PageSize)
+	if limit <= 0 {
+		limit = defaultPageSize
+	}
+	if limit > maxPageSize {
+		limit = maxPageSize
+	}
+
+	offset, err := decodePageToken(q.PageToken)
+	if err != nil {
+		return nil, err
+	}
+
+	filter, err := productFilter(q.Filter)
+	if err != nil {
+		return nil, err
+	}
+
+	products, total, err := s.Products.List(ctx, repository.ProductQuery{
+		Listing: q.Listing,
+		Filter:  filter,
+		Sort:    productSorts[q.Sort],
+		Offset:  offset,
+		Limit:   limit,
+	})
+	if err != nil {
+		return nil, internalError("failed to fetch products", err)
+	}
+
+	page := &productPage{Products: products, TotalCount: total}
+	if int64(offset+len(products)) < total {
+		page.NextPageToken = encodePageToken(offset + len(products))
+	}
+	return page, nil
+}
+
+// productFilter converts the filter of a listing request. Prices compare in
+// minor units, the old float bounds still work.
+func productFilter(f *pb.ProductFilter) (repository.ProductFilter, error) {
+	var filter repository.ProductFilter
+	if f == nil {
+		return filter, nil
+	}
+
+	filter.CategoryName = f.CategoryName
+	filter.CategoryID = uint(f.CategoryId)
+	filter.InStockOnly = f.InStockOnly
+	filter.NameContains = f.NameContains
+
+	switch {
+	case f.MinListPrice != nil:
+		minor, _, err := money.FromProto(f.MinListPrice, money.DefaultCurrency)
+		if err != nil {
+			return filter, invalidArgument(pb.ErrorReason_INVALID_PRICE, "invalid minimum price")
+		}
+		filter.MinPriceMinor = &minor
+	case f.MinPrice != nil:
+		minor, err := money.FromFloat(f.GetMinPrice())
+		if err != nil {
+			return filter, invalidArgument(pb.ErrorReason_INVALID_PRICE, "invalid minimum price")
+		}
+		filter.MinPriceMinor = &minor
+	}
+	switch {
+	case f.MaxListPrice != nil:
+		minor, _, err := money.FromProto(f.MaxListPrice, money.DefaultCurrency)
+		if err != nil {
+			return filter, invalidArgument(pb.ErrorReason_INVALID_PRICE, "invalid maximum price")
+		}
+		filter.MaxPriceMinor = &minor
+	case f.MaxPrice != nil:
+		minor, err := money.FromFloat(f.GetMaxPrice())
+		if err != nil {
+			return filter, invalidArgument(pb.ErrorReason_INVALID_PRICE, "invalid maximum price")
+		}
+		filter.MaxPriceMinor = &minor
+	}
+	return filter, nil
+}
+
+// Page tokens are opaque to clients, they only carry the offset of the next page.
+func encodePageToken(offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(offset)))
+}
+
+func decodePageToken(token string) (int, error) {
+	if token == "" {
+		return 0, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return 0, errInvalidPageToken
+	}
+	offset, err := strconv.Atoi(string(raw))
+	if err != nil || offset < 0 {
+		return 0, errInvalidPageToken
+	}
+	return offset, nil
+}
@@ -0,0 +1,217 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Manuelmastro/mobilehub-product/v3/pkg/models"
+	"github.com/Manuelmastro/mobilehub-product/v3/pkg/pb"
+	"github.com/Manuelmastro/mobilehub-product/v3/pkg/repository"
+	"github.com/Manuelmastro/mobilehub-product/v3/pkg/validation"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	defaultReservationTTL = 15 * time.Minute
+	maxReservationTTL     = 24 * time.Hour
+
+	// sweepBatchSize bounds how many expired reservations one sweep releases.
+	sweepBatchSize = 100
+)
+
+var (
+	errReservationNotFound = repository.ErrReservationNotFound
+	errReservationState    = repository.ErrReservationState
+)
+
+func (s *ProductServiceServer) ReserveStock(ctx context.Context, req *pb.ReserveStockRequest) (*pb.ReserveStockResponse, error) {
+	if err := validation.StockLines(req.Lines); err != nil {
+		return nil, validationError(err)
+	}
+
+	ttl := s.ReservationTTL
+	if ttl <= 0 {
+		ttl = defaultReservationTTL
+	}
+	if req.TtlSeconds > 0 {
+		ttl = time.Duration(req.TtlSeconds) * time.Second
+	}
+	if ttl > maxReservationTTL {
+		ttl = maxReservationTTL
+	}
+
+	var lineErrs []error
+	response, err := idempotent(ctx, s, pb.ProductService_ReserveStock_FullMethodName, req.IdempotencyKey, req,
+		func(tx repository.InventoryRepository) (*pb.ReserveStockResponse, error) {
+			reservation := models.Reservation{
+				Reference: req.Reference,
+				Status:    models.ReservationPending,
+				ExpiresAt: time.Now().Add(ttl),
+			}
+			for _, line := range req.Lines {
+				reservation.Items = append(reservation.Items, models.ReservationItem{
+					ProductID: uint(line.ProductId),
+					VariantID: uint(line.VariantId),
+					Quantity:  line.Quantity,
+				})
+			}
+			if err := tx.CreateReservation(ctx, &reservation); err != nil {
+				return nil, err
+			}
+
+			var err error
+			lineErrs, err = reduceStockLines(ctx, tx, req.Lines, repository.Movement{
+				Reason:    models.MovementReservation,
+				Reference: reservationReference(reservation),
+				Caller:    callerFromContext(ctx),
+			})
+			if err != nil {
+				return nil, err
+			}
+
+			return &pb.ReserveStockResponse{
+				Success:       true,
+				Message:       "Stock reserved successfully",
+				ReservationId: int64(reservation.ID),
+				ExpiresAt:     timestamppb.New(reservation.ExpiresAt),
+				Results:       stockLineResults(req.Lines, lineErrs),
+			}, nil
+		})
+	if errors.Is(err, errBatchRejected) {
+		return nil, batchRejected(req.Lines, lineErrs, "no stock reserved", &pb.ReserveStockResponse{
+			Message: "No stock reserved",
+			Results: stockLineResults(req.Lines, lineErrs),
+		})
+	}
+	if err != nil {
+		return nil, stockError(err, nil, "failed to reserve stock")
+	}
+
+	return response, nil
+}
+
+func (s *ProductServiceServer) CommitReservation(ctx context.Context, req *pb.CommitReservationRequest) (*pb.CommitReservationResponse, error) {
+	// The stock already left the shelf when it was reserved, committing only
+	// stops the sweeper from giving it back.
+	err := s.Inventory.CommitReservation(ctx, uint(req.ReservationId), time.Now())
+	if err != nil && !errors.Is(err, errReservationState) && !errors.Is(err, errReservationNotFound) {
+		return nil, internalError("failed to commit reservation", err)
+	}
+	if err == nil {
+		return &pb.CommitReservationResponse{
+			Success: true,
+			Message: "Reservation committed successfully",
+		}, nil
+	}
+
+	reservation, err := s.findReservation(ctx, req.ReservationId)
+	if err != nil {
+		return nil, err
+	}
+
+	switch reservation.Status {
+	case models.ReservationCommitted:
+		return &pb.CommitReservationResponse{
+			Success: true,
+			Message: "Reservation already committed",
+		}, nil
+	case models.ReservationPending, models.ReservationExpired:
+		return nil, reservationError(codes.FailedPrecondition, pb.ErrorReason_RESERVATION_EXPIRED, "reservation expired", reservation.ID)
+	default:
+		return nil, reservationError(codes.FailedPrecondition, pb.ErrorReason_RESERVATION_RELEASED, "reservation was released", reservation.ID)
+	}
+}
+
+func (s *ProductServiceServer) ReleaseReservation(ctx context.Context, req *pb.ReleaseReservationRequest) (*pb.ReleaseReservationResponse, error) {
+	err := s.releaseReservation(ctx, uint(req.ReservationId), models.ReservationReleased, callerFromContext(ctx))
+	if err == nil {
+		return &pb.ReleaseReservationResponse{
+			Success: true,
+			Message: "Reservation released successfully",
+		}, nil
+	}
+	if errors.Is(err, errReservationNotFound) {
+		return nil, reservationError(codes.NotFound, pb.ErrorReason_RESERVATION_NOT_FOUND, "reservation not found", uint(req.ReservationId))
+	}
+	if !errors.Is(err, errReservationState) {
+		return nil, internalError("failed to release reservation", err)
+	}
+
+	reservation, err := s.findReservation(ctx, req.ReservationId)
+	if err != nil {
+		return nil, err
+	}
+	if reservation.Status == models.ReservationCommitted {
+		return nil, reservationError(codes.FailedPrecondition, pb.ErrorReason_RESERVATION_COMMITTED, "reservation already committed", reservation.ID)
+	}
+	// Released or expired, either way the stock is already back.
+	return &pb.ReleaseReservationResponse{
+		Success: true,
+		Message: "Reservation already " + reservation.Status,
+	}, nil
+}
+
+func (s *ProductServiceServer) findReservation(ctx context.Context, id int64) (models.Reservation, error) {
+	reservation, err := s.Inventory.Reservation(ctx, uint(id))
+	if errors.Is(err, errReservationNotFound) {
+		return reservation, reservationError(codes.NotFound, pb.ErrorReason_RESERVATION_NOT_FOUND, "reservation not found", uint(id))
+	}
+	if err != nil {
+		return reservation, internalError("failed to fetch reservation", err)
+	}
+	return reservation, nil
+}
+
+func reservationError(code codes.Code, reason pb.ErrorReason, msg string, id uint) error {
+	return statusError(code, reason, msg, map[string]string{"reservation_id": fmt.Sprint(id)})
+}
+
+// ReleaseExpiredReservations returns the stock of pending reservations past
+// their expiry. It is run periodically by the reservation sweeper and is safe
+// to run on several replicas at once, each reservation is released only once.
+func (s *ProductServiceServer) ReleaseExpiredReservations(ctx context.Context) error {
+	ids, err := s.Inventory.ExpiredReservations(ctx, time.Now(), sweepBatchSize)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		err := s.releaseReservation(ctx, id, models.ReservationExpired, "reservation-sweeper")
+		if err != nil && !errors.Is(err, errReservationState) {
+			return err
+		}
+	}
+	return nil
+}
+
+// releaseReservation moves a pending reservation to status and puts its items
+// back on stock in the same transaction. Only one caller can win the
+// transition.
+func (s *ProductServiceServer) releaseReservation(ctx context.Context, id uint, status, caller string) error {
+	reason := models.MovementReservationRelease
+	if status == models.ReservationExpired {
+		reason = models.MovementReservationExpiry
+	}
+
+	return s.Inventory.Atomically(ctx, func(tx repository.InventoryRepository) error {
+		reservation, err := tx.FinishReservation(ctx, id, status)
+		if err != nil {
+			return err
+		}
+		m := repository.Movement{
+			Reason:    reason,
+			Reference: reservationReference(reservation),
+			Caller:    caller,
+		}
+		for _, item := range reservation.Items {
+			held := repository.StockItem{ProductID: item.ProductID, VariantID: item.VariantID}
+			if err := restoreStock(ctx, tx, held, item.Quantity, m); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,69 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Manuelmastro/mobilehub-product/v3/pkg/models"
+	"github.com/Manuelmastro/mobilehub-product/v3/pkg/pb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestReservationReleaseAndExpiry(t *testing.T) {
+	s, gormDB := newTestServer(t)
+
+	product := models.Product{ProductName: "reservation test", Stock: 5}
+	if err := gormDB.Create(&product).Error; err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { gormDB.Unscoped().Delete(&product) })
+
+	stock := func() int32 {
+		t.Helper()
+		var p models.Product
+		if err := gormDB.First(&p, product.ID).Error; err != nil {
+			t.Fatal(err)
+		}
+		return p.Stock
+	}
+	reserve := func() int64 {
+		t.Helper()
+		res, err := s.ReserveStock(context.Background(), &pb.ReserveStockRequest{
+			Lines: []*pb.StockLine{{ProductId: int64(product.ID), Quantity: 2}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res.ReservationId
+	}
+
+	id := reserve()
+	if got := stock(); got != 3 {
+		t.Fatalf("stock after reserve = %d, want 3", got)
+	}
+	if _, err := s.ReleaseReservation(context.Background(), &pb.ReleaseReservationRequest{ReservationId: id}); err != nil {
+		t.Fatal(err)
+	}
+	if got := stock(); got != 5 {
+		t.Fatalf("stock after release = %d, want 5", got)
+	}
+
+	id = reserve()
+	if err := gormDB.Model(&models.Reservation{}).Where("id = ?", id).
+		Update("expires_at", time.Now().Add(-time.Minute)).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := s.ReleaseExpiredReservations(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := stock(); got != 5 {
+		t.Fatalf("stock after sweep = %d, want 5", got)
+	}
+
+	_, err := s.CommitReservation(context.Background(), &pb.CommitReservationRequest{ReservationId: id})
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("commit of expired reservation: got %v, want FailedPrecondition", err)
+	}
+}
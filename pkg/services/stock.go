@@ -0,0 +1,120 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sort"
+
+	"github.com/Manuelmastro/mobilehub-product/v3/pkg/pb"
+	"github.com/Manuelmastro/mobilehub-product/v3/pkg/repository"
+)
+
+var (
+	errInvalidQuantity = errors.New("quantity must be positive")
+
+	// errBatchRejected rolls back a batch in which at least one line failed.
+	errBatchRejected = errors.New("batch rejected")
+
+	// The repository reports these, the status mapping is shared.
+	errProductNotFound       = repository.ErrProductNotFound
+	errProductDiscontinued   = repository.ErrProductDiscontinued
+	errVariantRequired       = repository.ErrVariantRequired
+	errVariantNotFound       = repository.ErrVariantNotFound
+	errInsufficientStock     = repository.ErrInsufficientStock
+	errConcurrentStockChange = repository.ErrConcurrentStockChange
+)
+
+func lineItem(line *pb.StockLine) repository.StockItem {
+	return repository.StockItem{ProductID: uint(line.ProductId), VariantID: uint(line.VariantId)}
+}
+
+// reduceStock takes quantity off a product or variant. The inventory never
+// takes stock below zero and never sells a deleted product.
+func reduceStock(ctx context.Context, tx repository.InventoryRepository, item repository.StockItem, quantity int32, m repository.Movement) error {
+	if quantity <= 0 {
+		return errInvalidQuantity
+	}
+	return tx.Reduce(ctx, item, quantity, m)
+}
+
+// restoreStock puts quantity back on a product or variant. Stock held for a
+// product that was deleted since still belongs to it.
+func restoreStock(ctx context.Context, tx repository.InventoryRepository, item repository.StockItem, quantity int32, m repository.Movement) error {
+	if quantity <= 0 {
+		return errInvalidQuantity
+	}
+	return tx.Restore(ctx, item, quantity, m)
+}
+
+// reduceStockLines reduces every line on tx and returns the outcome of each
+// line in request order, or errBatchRejected if any line failed. Lines are
+// applied in product and variant ID order so that concurrent batches lock rows
+// in the same order and cannot deadlock.
+func reduceStockLines(ctx context.Context, tx repository.InventoryRepository, lines []*pb.StockLine, m repository.Movement) ([]error, error) {
+	order := make([]int, len(lines))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		la, lb := lines[order[a]], lines[order[b]]
+		if la.ProductId != lb.ProductId {
+			return la.ProductId < lb.ProductId
+		}
+		return la.VariantId < lb.VariantId
+	})
+
+	results := make([]error, len(lines))
+	failed := false
+	for _, i := range order {
+		err := reduceStock(ctx, tx, lineItem(lines[i]), lines[i].Quantity, m)
+		switch {
+		case err == nil:
+		case errors.Is(err, errProductNotFound),
+			errors.Is(err, errVariantNotFound),
+			errors.Is(err, errVariantRequired),
+			errors.Is(err, errInsufficientStock),
+			errors.Is(err, errInvalidQuantity):
+			results[i] = err
+			failed = true
+		default:
+			return nil, err
+		}
+	}
+	if failed {
+		return results, errBatchRejected
+	}
+	return results, nil
+}
+
+// stockLineResults maps the per-line errors of a batch onto response results.
+func stockLineResults(lines []*pb.StockLine, lineErrs []error) []*pb.StockLineResult {
+	var results []*pb.StockLineResult
+	for i, line := range lines {
+		result := &pb.StockLineResult{
+			ProductId: line.ProductId,
+			VariantId: line.VariantId,
+			Quantity:  line.Quantity,
+			Status:    pb.StockLineStatus_STOCK_LINE_STATUS_OK,
+		}
+		switch {
+		case lineErrs[i] == nil:
+		case errors.Is(lineErrs[i], errProductNotFound):
+			result.Status = pb.StockLineStatus_STOCK_LINE_STATUS_NOT_FOUND
+			result.Message = "Product not found"
+		case errors.Is(lineErrs[i], errVariantNotFound):
+			result.Status = pb.StockLineStatus_STOCK_LINE_STATUS_NOT_FOUND
+			result.Message = "Variant not found"
+		case errors.Is(lineErrs[i], errVariantRequired):
+			result.Status = pb.StockLineStatus_STOCK_LINE_STATUS_VARIANT_REQUIRED
+			result.Message = "Variant required"
+		case errors.Is(lineErrs[i], errInsufficientStock):
+			result.Status = pb.StockLineStatus_STOCK_LINE_STATUS_INSUFFICIENT_STOCK
+			result.Message = "Insufficient stock"
+		case errors.Is(lineErrs[i], errInvalidQuantity):
+			result.Status = pb.StockLineStatus_STOCK_LINE_STATUS_INVALID_QUANTITY
+			result.Message = "Invalid quantity"
+		}
+		results = append(results, result)
+	}
+	return results
+}
@@ -0,0 +1,309 @@
+package services
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/Manuelmastro/mobilehub-product/v3/pkg/db"
+	"github.com/Manuelmastro/mobilehub-product/v3/pkg/models"
+	"github.com/Manuelmastro/mobilehub-product/v3/pkg/pb"
+	"github.com/Manuelmastro/mobilehub-product/v3/pkg/repository"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"gorm.io/gorm"
+)
+
+// newTestServer connects to the database named by TEST_DB_URL, or to a
+// SQLite file of the test's own without one. An in-memory database would do
+// with a single connection, which would queue the concurrent buyers of the
+// stock tests up instead of letting them race for the write lock. Run the
+// stock tests against PostgreSQL too, only there do they race for rows.
+func newTestServer(t *testing.T) (*ProductServiceServer, *gorm.DB) {
+	t.Helper()
+	url := os.Getenv("TEST_DB_URL")
+	if url == "" {
+		url = "sqlite://" + filepath.Join(t.TempDir(), "product.db")
+	}
+	h, err := db.Connect(url, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := h.DB.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return &ProductServiceServer{
+		Products:   repository.NewGormProducts(h.DB),
+		Variants:   repository.NewGormVariants(h.DB),
+		Categories: repository.NewGormCategories(h.DB),
+		Offers:     repository.NewGormOffers(h.DB),
+		Inventory:  repository.NewGormInventory(h.DB),
+	}, h.DB
+}
+
+func TestReduceStockConcurrentNoOversell(t *testing.T) {
+	s, gormDB := newTestServer(t)
+
+	const stock, buyers = 20, 100
+
+	product := models.Product{ProductName: "concurrency test", Stock: stock}
+	if err := gormDB.Create(&product).Error; err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { gormDB.Unscoped().Delete(&product) })
+
+	var sold atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < buyers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := s.ReduceStock(context.Background(), &pb.ReduceStockRequest{
+				ProductId: int64(product.ID),
+				Quantity:  1,
+			})
+			switch status.Code(err) {
+			case codes.OK:
+				sold.Add(1)
+			case codes.FailedPrecondition:
+			default:
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := sold.Load(); got != stock {
+		t.Errorf("sold %d units, want %d", got, stock)
+	}
+
+	var after models.Product
+	if err := gormDB.First(&after, product.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if after.Stock != 0 {
+		t.Errorf("stock after sell-out = %d, want 0", after.Stock)
+	}
+}
+
+func TestReduceStockRejectsBadQuantity(t *testing.T) {
+	s, gormDB := newTestServer(t)
+
+	product := models.Product{ProductName: "quantity test", Stock: 5}
+	if err := gormDB.Create(&product).Error; err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { gormDB.Unscoped().Delete(&product) })
+
+	for qty, want := range map[int32]codes.Code{
+		0:  codes.InvalidArgument,
+		-3: codes.InvalidArgument,
+		6:  codes.FailedPrecondition,
+	} {
+		_, err := s.ReduceStock(context.Background(), &pb.ReduceStockRequest{
+			ProductId: int64(product.ID),
+			Quantity:  qty,
+		})
+		if got := status.Code(err); got != want {
+			t.Errorf("quantity %d: got %v, want %v", qty, got, want)
+		}
+	}
+
+	var after models.Product
+	if err := gormDB.First(&after, product.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if after.Stock != 5 {
+		t.Errorf("stock = %d, want 5", after.Stock)
+	}
+}
+
+func TestBatchReduceStockAllOrNothing(t *testing.T) {
+	s, gormDB := newTestServer(t)
+
+	a := models.Product{ProductName: "batch test a", Stock: 10}
+	b := models.Product{ProductName: "batch test b", Stock: 1}
+	for _, p := range []*models.Product{&a, &b} {
+		if err := gormDB.Create(p).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Cleanup(func() { gormDB.Unscoped().Delete(&[]models.Product{a, b}) })
+
+	_, err := s.BatchReduceStock(context.Background(), &pb.BatchReduceStockRequest{
+		Lines: []*pb.StockLine{
+			{ProductId: int64(a.ID), Quantity: 3},
+			{ProductId: int64(b.ID), Quantity: 2},
+		},
+	})
+	st := status.Convert(err)
+	if st.Code() != codes.FailedPrecondition {
+		t.Fatalf("got %v, want FailedPrecondition", err)
+	}
+	var violations []*errdetails.PreconditionFailure_Violation
+	var results []*pb.StockLineResult
+	for _, d := range st.Details() {
+		switch d := d.(type) {
+		case *errdetails.PreconditionFailure:
+			violations = d.Violations
+		case *pb.BatchReduceStockResponse:
+			results = d.Results
+		}
+	}
+	if len(violations) != 1 || violations[0].Subject != "lines[1]" || violations[0].Type != "INSUFFICIENT_STOCK" {
+		t.Errorf("violations = %v, want lines[1] INSUFFICIENT_STOCK", violations)
+	}
+	if len(results) != 2 ||
+		results[0].Status != pb.StockLineStatus_STOCK_LINE_STATUS_OK ||
+		results[1].Status != pb.StockLineStatus_STOCK_LINE_STATUS_INSUFFICIENT_STOCK {
+		t.Errorf("results = %v, want line 0 OK and line 1 INSUFFICIENT_STOCK", results)
+	}
+
+	var after models.Product
+	if err := gormDB.First(&after, a.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if after.Stock != 10 {
+		t.Errorf("stock of a = %d, want 10 after rollback", after.Stock)
+	}
+}
+
+func TestRestoreStock(t *testing.T) {
+	s, gormDB := newTestServer(t)
+
+	product := models.Product{ProductName: "restore test", Stock: 1}
+	if err := gormDB.Create(&product).Error; err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { gormDB.Unscoped().Delete(&product) })
+
+	_, err := s.RestoreStock(context.Background(), &pb.RestoreStockRequest{
+		ProductId: int64(product.ID),
+		Quantity:  4,
+	})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("restore without a reason: got %v, want InvalidArgument", err)
+	}
+
+	res, err := s.RestoreStock(context.Background(), &pb.RestoreStockRequest{
+		ProductId: int64(product.ID),
+		Quantity:  4,
+		Reason:    pb.RestockReason_RESTOCK_REASON_RETURN,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Success {
+		t.Fatalf("restore failed: %s", res.Message)
+	}
+
+	var after models.Product
+	if err := gormDB.First(&after, product.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if after.Stock != 5 {
+		t.Errorf("stock = %d, want 5", after.Stock)
+	}
+}
+
+// Once a product has variants its stock is theirs, a restore has to name one.
+func TestRestoreStockRequiresVariant(t *testing.T) {
+	s, gormDB := newTestServer(t)
+	ctx := context.Background()
+
+	product := models.Product{ProductName: "restore variant test", Stock: 2}
+	if err := gormDB.Create(&product).Error; err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		gormDB.Unscoped().Where("product_id = ?", product.ID).Delete(&models.Variant{})
+		gormDB.Unscoped().Delete(&product)
+	})
+	variant, err := s.AddVariant(ctx, &pb.AddVariantRequest{
+		ProductId: int64(product.ID),
+		Sku:       "RVT-BLU",
+		Options:   []*pb.VariantOption{{Name: "color", Value: "Blue"}},
+		Price:     &pb.Money{CurrencyCode: "INR", Units: 1999},
+		Stock:     3,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = s.RestoreStock(ctx, &pb.RestoreStockRequest{
+		ProductId: int64(product.ID),
+		Quantity:  4,
+		Reason:    pb.RestockReason_RESTOCK_REASON_RETURN,
+	})
+	if status.Code(err) != codes.FailedPrecondition || errorReason(err) != pb.ErrorReason_VARIANT_REQUIRED.String() {
+		t.Fatalf("restore without variant: got %v, want FailedPrecondition VARIANT_REQUIRED", err)
+	}
+
+	if _, err := s.RestoreStock(ctx, &pb.RestoreStockRequest{
+		ProductId: int64(product.ID),
+		VariantId: variant.Variant.Id,
+		Quantity:  4,
+		Reason:    pb.RestockReason_RESTOCK_REASON_RETURN,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	var after models.Product
+	if err := gormDB.First(&after, product.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if after.Stock != 0 {
+		t.Errorf("product stock = %d, want 0", after.Stock)
+	}
+	if stock := variantStock(t, gormDB, variant.Variant.Id); stock != 7 {
+		t.Errorf("variant stock = %d, want 7", stock)
+	}
+}
+
+func TestReduceStockIdempotencyKey(t *testing.T) {
+	s, gormDB := newTestServer(t)
+
+	product := models.Product{ProductName: "idempotency test", Stock: 10}
+	if err := gormDB.Create(&product).Error; err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { gormDB.Unscoped().Delete(&product) })
+
+	req := &pb.ReduceStockRequest{
+		ProductId:      int64(product.ID),
+		Quantity:       3,
+		IdempotencyKey: "order-42-" + product.CreatedAt.String(),
+	}
+	for i := 0; i < 3; i++ {
+		res, err := s.ReduceStock(context.Background(), req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !res.Success {
+			t.Fatalf("attempt %d failed: %s", i, res.Message)
+		}
+	}
+
+	var after models.Product
+	if err := gormDB.First(&after, product.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if after.Stock != 7 {
+		t.Errorf("stock after retries = %d, want 7", after.Stock)
+	}
+
+	_, err := s.ReduceStock(context.Background(), &pb.ReduceStockRequest{
+		ProductId:      int64(product.ID),
+		Quantity:       1,
+		IdempotencyKey: req.IdempotencyKey,
+	})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("reused key with a different request: got %v, want InvalidArgument", err)
+	}
+}
@@ -0,0 +1,180 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Manuelmastro/mobilehub-product/v3/pkg/models"
+	"github.com/Manuelmastro/mobilehub-product/v3/pkg/money"
+	"github.com/Manuelmastro/mobilehub-product/v3/pkg/pb"
+	"github.com/Manuelmastro/mobilehub-product/v3/pkg/repository"
+	"github.com/Manuelmastro/mobilehub-product/v3/pkg/validation"
+	"google.golang.org/grpc/codes"
+)
+
+var (
+	errSKUTaken         = repository.ErrSKUTaken
+	errDuplicateVariant = repository.ErrDuplicateVariant
+)
+
+// variantToProto converts a variant, priced with the running offers of its product.
+func variantToProto(v models.Variant, offers []models.Offer) *pb.Variant {
+	effective, _ := bestPrice(offers, v.PriceMinor, v.Currency)
+	variant := &pb.Variant{
+		Id:        int64(v.ID),
+		ProductId: int64(v.ProductID),
+		Sku:       v.SKU,
+		Price:     money.ToProto(v.PriceMinor, v.Currency),
+		Stock:     v.Stock,
+		ImageUrl:  v.ImageUrl,
+
+		EffectivePrice: money.ToProto(effective, v.Currency),
+	}
+	for _, o := range v.Options {
+		variant.Options = append(variant.Options, &pb.VariantOption{Name: o.Name, Value: o.Value})
+	}
+	return variant
+}
+
+// productOptions summarizes the options of variants for a storefront: every
+// option name with the values some variant has, both in first-seen order.
+func productOptions(variants []models.Variant) []*pb.ProductOption {
+	var options []*pb.ProductOption
+	byName := map[string]*pb.ProductOption{}
+	seen := map[string]bool{}
+	for _, v := range variants {
+		for _, o := range v.Options {
+			name := strings.ToLower(o.Name)
+			option, ok := byName[name]
+			if !ok {
+				option = &pb.ProductOption{Name: o.Name}
+				byName[name] = option
+				options = append(options, option)
+			}
+			if key := name + "\x00" + o.Value; !seen[key] {
+				seen[key] = true
+				option.Values = append(option.Values, o.Value)
+			}
+		}
+	}
+	return options
+}
+
+func toVariantOptions(options []*pb.VariantOption) []models.VariantOption {
+	var result []models.VariantOption
+	for i, o := range options {
+		result = append(result, models.VariantOption{
+			Position: int32(i),
+			Name:     strings.TrimSpace(o.Name),
+			Value:    strings.TrimSpace(o.Value),
+		})
+	}
+	return result
+}
+
+func (s *ProductServiceServer) AddVariant(ctx context.Context, req *pb.AddVariantRequest) (*pb.AddVariantResponse, error) {
+	if err := validation.AddVariant(req); err != nil {
+		return nil, validationError(err)
+	}
+
+	price, currency, err := money.FromProto(req.Price, s.currency())
+	if err != nil {
+		return nil, invalidArgument(pb.ErrorReason_INVALID_PRICE, "invalid price")
+	}
+
+	variant := models.Variant{
+		ProductID:  uint(req.ProductId),
+		SKU:        req.Sku,
+		PriceMinor: price,
+		Currency:   currency,
+		Stock:      req.Stock,
+		ImageUrl:   req.ImageUrl,
+		Options:    toVariantOptions(req.Options),
+	}
+
+	// From its first variant on a product is sold per variant, the
+	// repository writes off the stock it held itself.
+	err = s.Variants.Create(ctx, &variant, callerFromContext(ctx))
+	if err != nil {
+		return nil, variantError(err, req.ProductId, 0, "failed to add variant")
+	}
+
+	offers, err := s.variantOffers(ctx, variant.ProductID)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.AddVariantResponse{Variant: variantToProto(variant, offers)}, nil
+}
+
+func (s *ProductServiceServer) UpdateVariant(ctx context.Context, req *pb.UpdateVariantRequest) (*pb.UpdateVariantResponse, error) {
+	if err := validation.UpdateVariant(req); err != nil {
+		return nil, validationError(err)
+	}
+
+	change := repository.VariantChange{Caller: callerFromContext(ctx)}
+	for _, path := range validation.VariantMask(req) {
+		switch path {
+		case validation.VariantPathSKU:
+			change.SKU = &req.Sku
+		case validation.VariantPathOptions:
+			change.Options = toVariantOptions(req.Options)
+		case validation.VariantPathPrice:
+			price, currency, err := money.FromProto(req.Price, s.currency())
+			if err != nil {
+				return nil, variantError(err, 0, req.Id, "failed to update variant")
+			}
+			change.PriceMinor, change.Currency = &price, currency
+		case validation.VariantPathImageURL:
+			change.ImageURL = &req.ImageUrl
+		case validation.VariantPathStock:
+			change.Stock = &req.Stock
+		}
+	}
+
+	variant, err := s.Variants.Update(ctx, uint(req.Id), change)
+	if err != nil {
+		return nil, variantError(err, int64(variant.ProductID), req.Id, "failed to update variant")
+	}
+
+	offers, err := s.variantOffers(ctx, variant.ProductID)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.UpdateVariantResponse{Variant: variantToProto(variant, offers)}, nil
+}
+
+// DeleteVariant takes a variant off sale. Its ledger and any stock pending
+// reservations hold stay, a released reservation still puts stock back on it.
+func (s *ProductServiceServer) DeleteVariant(ctx context.Context, req *pb.DeleteVariantRequest) (*pb.DeleteVariantResponse, error) {
+	if err := s.Variants.Delete(ctx, uint(req.Id)); err != nil {
+		return nil, variantError(err, 0, req.Id, "failed to delete variant")
+	}
+
+	return &pb.DeleteVariantResponse{
+		Status:  true,
+		Message: "Variant deleted successfully",
+	}, nil
+}
+
+// variantError maps the errors of the variant RPCs to statuses.
+func variantError(err error, productID, variantID int64, msg string) error {
+	switch {
+	case errors.Is(err, errVariantNotFound):
+		return statusError(codes.NotFound, pb.ErrorReason_VARIANT_NOT_FOUND, "variant not found",
+			map[string]string{"variant_id": fmt.Sprint(variantID)})
+	case errors.Is(err, errSKUTaken):
+		return statusError(codes.AlreadyExists, pb.ErrorReason_SKU_TAKEN, "sku is taken", nil)
+	case errors.Is(err, errDuplicateVariant):
+		return statusError(codes.AlreadyExists, pb.ErrorReason_DUPLICATE_VARIANT,
+			"another variant of the product has the same options", map[string]string{"product_id": fmt.Sprint(productID)})
+	case errors.Is(err, money.ErrInvalid):
+		return invalidArgument(pb.ErrorReason_INVALID_PRICE, "invalid price")
+	case errors.Is(err, errConcurrentStockChange):
+		return statusError(codes.Aborted, pb.ErrorReason_CONCURRENT_MODIFICATION,
+			"stock changed while editing, retry the request", map[string]string{"variant_id": fmt.Sprint(variantID)})
+	default:
+		return stockError(err, productID, msg)
+	}
+}
@@ -0,0 +1,185 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/Manuelmastro/mobilehub-product/v3/pkg/models"
+	"github.com/Manuelmastro/mobilehub-product/v3/pkg/pb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"gorm.io/gorm"
+)
+
+func TestVariantStock(t *testing.T) {
+	s, gormDB := newTestServer(t)
+	ctx := context.Background()
+
+	product := models.Product{ProductName: "variant test phone"}
+	if err := gormDB.Create(&product).Error; err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		gormDB.Unscoped().Where("product_id = ?", product.ID).Delete(&models.Variant{})
+		gormDB.Unscoped().Delete(&product)
+	})
+
+	add := func(sku, color string, stock int32) (*pb.Variant, error) {
+		res, err := s.AddVariant(ctx, &pb.AddVariantRequest{
+			ProductId: int64(product.ID),
+			Sku:       sku,
+			Options:   []*pb.VariantOption{{Name: "color", Value: color}, {Name: "storage", Value: "128 GB"}},
+			Price:     &pb.Money{CurrencyCode: "INR", Units: 69999},
+			Stock:     stock,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return res.Variant, nil
+	}
+
+	black, err := add("VT-BLK-128", "Black", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := add("VT-BLU-128", "Blue", 2); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := add("VT-BLK-128", "Green", 1); status.Code(err) != codes.AlreadyExists {
+		t.Fatalf("duplicate sku: got %v, want AlreadyExists", err)
+	}
+	if _, err := add("VT-BLK-128-B", "black", 1); status.Code(err) != codes.AlreadyExists {
+		t.Fatalf("duplicate options: got %v, want AlreadyExists", err)
+	}
+
+	got, err := s.GetProduct(ctx, &pb.GetProductRequest{Id: fmt.Sprint(product.ID)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Product.Stock != 5 || len(got.Product.Variants) != 2 ||
+		len(got.Product.Options) != 2 || len(got.Product.Options[0].Values) != 2 {
+		t.Fatalf("product = %v, want stock 5 over 2 variants with color and storage options", got.Product)
+	}
+
+	// Stock is per variant once a product has variants.
+	_, err = s.ReduceStock(ctx, &pb.ReduceStockRequest{ProductId: int64(product.ID), Quantity: 1})
+	if reason := errorReason(err); reason != pb.ErrorReason_VARIANT_REQUIRED.String() {
+		t.Fatalf("reduce without variant: got %v, want VARIANT_REQUIRED", err)
+	}
+	_, err = s.RestoreStock(ctx, &pb.RestoreStockRequest{
+		ProductId: int64(product.ID),
+		Quantity:  4,
+		Reason:    pb.RestockReason_RESTOCK_REASON_RETURN,
+	})
+	if status.Code(err) != codes.FailedPrecondition || errorReason(err) != pb.ErrorReason_VARIANT_REQUIRED.String() {
+		t.Fatalf("restore without variant: got %v, want FailedPrecondition VARIANT_REQUIRED", err)
+	}
+	_, err = s.ReduceStock(ctx, &pb.ReduceStockRequest{ProductId: int64(product.ID), VariantId: black.Id, Quantity: 4})
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("oversell variant: got %v, want FailedPrecondition", err)
+	}
+
+	res, err := s.ReserveStock(ctx, &pb.ReserveStockRequest{
+		Lines: []*pb.StockLine{{ProductId: int64(product.ID), VariantId: black.Id, Quantity: 2}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stock := variantStock(t, gormDB, black.Id); stock != 1 {
+		t.Fatalf("stock after reserve = %d, want 1", stock)
+	}
+	if _, err := s.ReleaseReservation(ctx, &pb.ReleaseReservationRequest{ReservationId: res.ReservationId}); err != nil {
+		t.Fatal(err)
+	}
+	if stock := variantStock(t, gormDB, black.Id); stock != 3 {
+		t.Fatalf("stock after release = %d, want 3", stock)
+	}
+
+	movements, err := s.ListStockMovements(ctx, &pb.ListStockMovementsRequest{ProductId: int64(product.ID), VariantId: black.Id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(movements.Movements) != 3 || movements.Movements[0].Balance != 3 || movements.Movements[0].VariantId != black.Id {
+		t.Errorf("movements = %v, want initial, reservation and release of the black variant", movements.Movements)
+	}
+}
+
+// The stock a product held before its first variant cannot be sold or make
+// the product look in stock afterwards.
+func TestFirstVariantTakesOverStock(t *testing.T) {
+	s, gormDB := newTestServer(t)
+	ctx := context.Background()
+
+	product := models.Product{ProductName: "first variant test phone", Stock: 10}
+	if err := gormDB.Create(&product).Error; err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		gormDB.Unscoped().Where("product_id = ?", product.ID).Delete(&models.Variant{})
+		gormDB.Unscoped().Delete(&product)
+	})
+
+	if _, err := s.AddVariant(ctx, &pb.AddVariantRequest{
+		ProductId: int64(product.ID),
+		Sku:       "FVT-BLK",
+		Options:   []*pb.VariantOption{{Name: "color", Value: "Black"}},
+		Price:     &pb.Money{CurrencyCode: "INR", Units: 69999},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := s.ReduceStock(ctx, &pb.ReduceStockRequest{ProductId: int64(product.ID), Quantity: 3})
+	if reason := errorReason(err); reason != pb.ErrorReason_VARIANT_REQUIRED.String() {
+		t.Fatalf("reduce without variant: got %v, want VARIANT_REQUIRED", err)
+	}
+	_, err = s.RestoreStock(ctx, &pb.RestoreStockRequest{
+		ProductId: int64(product.ID),
+		Quantity:  4,
+		Reason:    pb.RestockReason_RESTOCK_REASON_RETURN,
+	})
+	if status.Code(err) != codes.FailedPrecondition || errorReason(err) != pb.ErrorReason_VARIANT_REQUIRED.String() {
+		t.Fatalf("restore without variant: got %v, want FailedPrecondition VARIANT_REQUIRED", err)
+	}
+
+	var after models.Product
+	if err := gormDB.First(&after, product.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if after.Stock != 0 {
+		t.Errorf("product stock = %d, want 0", after.Stock)
+	}
+	got, err := s.GetProduct(ctx, &pb.GetProductRequest{Id: fmt.Sprint(product.ID)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Product.Stock != 0 {
+		t.Errorf("GetProduct stock = %d, want 0", got.Product.Stock)
+	}
+	listed, err := s.GetProducts(ctx, &pb.GetProductsRequest{
+		Filter: &pb.ProductFilter{NameContains: product.ProductName, InStockOnly: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(listed.Products) != 0 {
+		t.Errorf("in stock products = %v, want none", listed.Products)
+	}
+
+	movements, err := s.ListStockMovements(ctx, &pb.ListStockMovementsRequest{ProductId: int64(product.ID)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(movements.Movements) != 1 || movements.Movements[0].Delta != -10 || movements.Movements[0].Balance != 0 {
+		t.Errorf("movements = %v, want the product stock written off", movements.Movements)
+	}
+}
+
+func variantStock(t *testing.T, gormDB *gorm.DB, id int64) int32 {
+	t.Helper()
+	var variant models.Variant
+	if err := gormDB.First(&variant, id).Error; err != nil {
+		t.Fatal(err)
+	}
+	return variant.Stock
+}
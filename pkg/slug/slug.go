@@ -0,0 +1,40 @@
+package slug
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+var valid = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// Make turns a display name into a URL slug: lower case ASCII letters and
+// digits separated by single dashes. "Smart Phones & Tablets" becomes
+// "smart-phones-tablets". Letters with accents lose them.
+func Make(name string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range norm.NFKD.String(name) {
+		r = unicode.ToLower(r)
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			dash = false
+		case unicode.Is(unicode.Mn, r):
+			// combining accent split off by NFKD
+		default:
+			dash = true
+		}
+	}
+	return b.String()
+}
+
+// Valid reports whether s is a well-formed slug.
+func Valid(s string) bool {
+	return valid.MatchString(s)
+}
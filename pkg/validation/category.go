@@ -0,0 +1,112 @@
+package validation
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/Manuelmastro/mobilehub-product/v3/pkg/pb"
+	"github.com/Manuelmastro/mobilehub-product/v3/pkg/slug"
+)
+
+// Update mask paths accepted by UpdateCategory.
+const (
+	CategoryPathName      = "name"
+	CategoryPathSlug      = "slug"
+	CategoryPathParent    = "parent_id"
+	CategoryPathSortOrder = "sort_order"
+)
+
+var allCategoryPaths = []string{CategoryPathName, CategoryPathSlug, CategoryPathParent, CategoryPathSortOrder}
+
+// CreateCategory checks a CreateCategoryRequest before anything is written.
+func CreateCategory(req *pb.CreateCategoryRequest) error {
+	var v Violations
+	categoryEntityName(&v, req.Name)
+	categorySlug(&v, req.Slug)
+	if req.Slug == "" && strings.TrimSpace(req.Name) != "" && slug.Make(req.Name) == "" {
+		v.Add("slug", "is required when the name has no letters or digits")
+	}
+	if req.ParentId < 0 {
+		v.Add("parentId", "must not be negative")
+	}
+	return v.Err()
+}
+
+// CategoryMask returns the fields an UpdateCategoryRequest changes, without
+// duplicates. Unknown paths are dropped, UpdateCategory reports them.
+func CategoryMask(req *pb.UpdateCategoryRequest) []string {
+	if len(req.GetUpdateMask().GetPaths()) == 0 {
+		return allCategoryPaths
+	}
+
+	var paths []string
+	seen := map[string]bool{}
+	for _, path := range req.UpdateMask.Paths {
+		if isCategoryPath(path) && !seen[path] {
+			seen[path] = true
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// UpdateCategory checks an UpdateCategoryRequest before anything is written.
+// Only the fields named by the update mask are checked.
+func UpdateCategory(req *pb.UpdateCategoryRequest) error {
+	var v Violations
+	if req.Id <= 0 {
+		v.Add("id", "must be positive")
+	}
+	for i, path := range req.GetUpdateMask().GetPaths() {
+		if !isCategoryPath(path) {
+			v.Add(fmt.Sprintf("updateMask.paths[%d]", i), "unknown field %q", path)
+		}
+	}
+
+	for _, path := range CategoryMask(req) {
+		switch path {
+		case CategoryPathName:
+			categoryEntityName(&v, req.Name)
+		case CategoryPathSlug:
+			categorySlug(&v, req.Slug)
+		case CategoryPathParent:
+			switch {
+			case req.ParentId < 0:
+				v.Add("parentId", "must not be negative")
+			case req.ParentId == req.Id:
+				v.Add("parentId", "must not be the category itself")
+			}
+		}
+	}
+	return v.Err()
+}
+
+func isCategoryPath(path string) bool {
+	for _, p := range allCategoryPaths {
+		if p == path {
+			return true
+		}
+	}
+	return false
+}
+
+func categoryEntityName(v *Violations, name string) {
+	switch {
+	case strings.TrimSpace(name) == "":
+		v.Add("name", "is required")
+	case utf8.RuneCountInString(name) > maxCategoryLength:
+		v.Add("name", "must be at most %d characters", maxCategoryLength)
+	}
+}
+
+// categorySlug checks an explicit slug, an empty one is derived from the name.
+func categorySlug(v *Violations, s string) {
+	switch {
+	case s == "":
+	case len(s) > maxCategoryLength:
+		v.Add("slug", "must be at most %d characters", maxCategoryLength)
+	case !slug.Valid(s):
+		v.Add("slug", "must be lower case letters and digits separated by single dashes")
+	}
+}
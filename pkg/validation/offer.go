@@ -0,0 +1,80 @@
+package validation
+
+import (
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Manuelmastro/mobilehub-product/v3/pkg/money"
+	"github.com/Manuelmastro/mobilehub-product/v3/pkg/pb"
+)
+
+const maxOfferNameLength = 100
+
+// CreateOffer checks a CreateOfferRequest before anything is written.
+func CreateOffer(req *pb.CreateOfferRequest) error {
+	var v Violations
+	switch {
+	case strings.TrimSpace(req.Name) == "":
+		v.Add("name", "is required")
+	case utf8.RuneCountInString(req.Name) > maxOfferNameLength:
+		v.Add("name", "must be at most %d characters", maxOfferNameLength)
+	}
+
+	switch {
+	case req.ProductId < 0:
+		v.Add("productId", "must not be negative")
+	case req.CategoryId < 0:
+		v.Add("categoryId", "must not be negative")
+	case (req.ProductId == 0) == (req.CategoryId == 0):
+		v.Add("productId", "exactly one of productId and categoryId is required")
+	}
+
+	switch req.Kind {
+	case pb.OfferKind_OFFER_KIND_PERCENT:
+		if req.PercentOff < 1 || req.PercentOff > 100 {
+			v.Add("percentOff", "must be between 1 and 100")
+		}
+		if req.AmountOff != nil {
+			v.Add("amountOff", "must not be set for percent offers")
+		}
+	case pb.OfferKind_OFFER_KIND_AMOUNT:
+		offerAmount(&v, req.AmountOff)
+		if req.PercentOff != 0 {
+			v.Add("percentOff", "must not be set for amount offers")
+		}
+	default:
+		v.Add("kind", "must be OFFER_KIND_PERCENT or OFFER_KIND_AMOUNT")
+	}
+
+	start := time.Now()
+	if req.StartsAt != nil {
+		if err := req.StartsAt.CheckValid(); err != nil {
+			v.Add("startsAt", "must be a valid timestamp")
+		}
+		start = req.StartsAt.AsTime()
+	}
+	if req.EndsAt != nil {
+		switch {
+		case req.EndsAt.CheckValid() != nil:
+			v.Add("endsAt", "must be a valid timestamp")
+		case !req.EndsAt.AsTime().After(start):
+			v.Add("endsAt", "must be after startsAt")
+		}
+	}
+	return v.Err()
+}
+
+func offerAmount(v *Violations, amount *pb.Money) {
+	if amount == nil {
+		v.Add("amountOff", "is required for amount offers")
+		return
+	}
+	minor, _, err := money.FromProto(amount, money.DefaultCurrency)
+	switch {
+	case err != nil:
+		v.Add("amountOff", "must have at most two decimal places and a three letter currency code")
+	case minor <= 0:
+		v.Add("amountOff", "must be positive")
+	}
+}
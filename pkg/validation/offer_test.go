@@ -0,0 +1,56 @@
+package validation
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Manuelmastro/mobilehub-product/v3/pkg/pb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func validOffer() *pb.CreateOfferRequest {
+	start := time.Now().Add(time.Hour)
+	return &pb.CreateOfferRequest{
+		Name:       "Diwali sale",
+		CategoryId: 2,
+		Kind:       pb.OfferKind_OFFER_KIND_PERCENT,
+		PercentOff: 15,
+		StartsAt:   timestamppb.New(start),
+		EndsAt:     timestamppb.New(start.Add(72 * time.Hour)),
+	}
+}
+
+func TestCreateOffer(t *testing.T) {
+	tests := []struct {
+		name   string
+		mutate func(*pb.CreateOfferRequest)
+		fields []string
+	}{
+		{"valid", func(*pb.CreateOfferRequest) {}, nil},
+		{"no name", func(r *pb.CreateOfferRequest) { r.Name = " " }, []string{"name"}},
+		{"no target", func(r *pb.CreateOfferRequest) { r.CategoryId = 0 }, []string{"productId"}},
+		{"two targets", func(r *pb.CreateOfferRequest) { r.ProductId = 5 }, []string{"productId"}},
+		{"no kind", func(r *pb.CreateOfferRequest) { r.Kind = pb.OfferKind_OFFER_KIND_UNSPECIFIED }, []string{"kind"}},
+		{"percent over 100", func(r *pb.CreateOfferRequest) { r.PercentOff = 101 }, []string{"percentOff"}},
+		{"amount offer", func(r *pb.CreateOfferRequest) {
+			r.Kind, r.PercentOff, r.AmountOff = pb.OfferKind_OFFER_KIND_AMOUNT, 0, &pb.Money{CurrencyCode: "INR", Units: 500}
+		}, nil},
+		{"amount offer without amount", func(r *pb.CreateOfferRequest) {
+			r.Kind, r.PercentOff = pb.OfferKind_OFFER_KIND_AMOUNT, 0
+		}, []string{"amountOff"}},
+		{"no start", func(r *pb.CreateOfferRequest) { r.StartsAt = nil }, nil},
+		{"no end", func(r *pb.CreateOfferRequest) { r.EndsAt = nil }, nil},
+		{"ends before start", func(r *pb.CreateOfferRequest) { r.EndsAt = timestamppb.New(r.StartsAt.AsTime()) }, []string{"endsAt"}},
+		{"ended already", func(r *pb.CreateOfferRequest) {
+			r.StartsAt, r.EndsAt = nil, timestamppb.New(time.Now().Add(-time.Minute))
+		}, []string{"endsAt"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := validOffer()
+			tt.mutate(req)
+			checkFields(t, CreateOffer(req), tt.fields)
+		})
+	}
+}
@@ -0,0 +1,237 @@
+package validation
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/Manuelmastro/mobilehub-product/v3/pkg/money"
+	"github.com/Manuelmastro/mobilehub-product/v3/pkg/pb"
+)
+
+const (
+	maxNameLength        = 200
+	maxDescriptionLength = 5000
+	maxCategoryLength    = 100
+	maxImageURLLength    = 2048
+)
+
+// AddProduct checks an AddProductRequest before anything is written.
+func AddProduct(req *pb.AddProductRequest) error {
+	var v Violations
+	productFields(&v, req.ProductName, req.Description, req.ImageUrl)
+	category(&v, req.CategoryId, req.CategoryName)
+	price(&v, req.ListPrice, req.Price)
+	if req.Stock < 0 {
+		v.Add("stock", "must not be negative")
+	}
+	return v.Err()
+}
+
+// Update mask paths accepted by EditProduct. "price" and "categoryName" are
+// the deprecated spellings of "listPrice" and "categoryId".
+const (
+	PathProductName = "productName"
+	PathDescription = "description"
+	PathImageURL    = "imageUrl"
+	PathListPrice   = "listPrice"
+	PathCategory    = "categoryId"
+	PathStock       = "stock"
+)
+
+var (
+	editPaths = map[string]string{
+		PathProductName: PathProductName,
+		PathDescription: PathDescription,
+		PathImageURL:    PathImageURL,
+		PathListPrice:   PathListPrice,
+		"price":         PathListPrice,
+		PathCategory:    PathCategory,
+		"categoryName":  PathCategory,
+		PathStock:       PathStock,
+	}
+
+	// defaultEditPaths is what an empty update mask means. Stock is left out
+	// on purpose, it has to be asked for explicitly.
+	defaultEditPaths = []string{PathProductName, PathDescription, PathImageURL, PathListPrice, PathCategory}
+)
+
+// EditMask returns the fields an EditProductRequest changes, with aliases
+// resolved and duplicates removed. Unknown paths are dropped, EditProduct
+// reports them.
+func EditMask(req *pb.EditProductRequest) []string {
+	if len(req.GetUpdateMask().GetPaths()) == 0 {
+		return defaultEditPaths
+	}
+
+	var paths []string
+	seen := map[string]bool{}
+	for _, path := range req.UpdateMask.Paths {
+		if field, ok := editPaths[path]; ok && !seen[field] {
+			seen[field] = true
+			paths = append(paths, field)
+		}
+	}
+	return paths
+}
+
+// EditProduct checks an EditProductRequest before anything is written. Only
+// the fields named by the update mask are checked.
+func EditProduct(req *pb.EditProductRequest) error {
+	var v Violations
+	if id, err := strconv.ParseUint(req.Id, 10, 0); err != nil || id == 0 {
+		v.Add("id", "must be a positive integer")
+	}
+	if req.ExpectedVersion <= 0 {
+		v.Add("expectedVersion", "is required")
+	}
+	for i, path := range req.GetUpdateMask().GetPaths() {
+		if _, ok := editPaths[path]; !ok {
+			v.Add(fmt.Sprintf("updateMask.paths[%d]", i), "unknown field %q", path)
+		}
+	}
+
+	for _, path := range EditMask(req) {
+		switch path {
+		case PathProductName:
+			productName(&v, req.ProductName)
+		case PathDescription:
+			description(&v, req.Description)
+		case PathImageURL:
+			imageURL(&v, req.ImageUrl)
+		case PathListPrice:
+			price(&v, req.ListPrice, req.Price)
+		case PathCategory:
+			category(&v, req.CategoryId, req.CategoryName)
+		case PathStock:
+			if req.Stock < 0 {
+				v.Add("stock", "must not be negative")
+			}
+		}
+	}
+	return v.Err()
+}
+
+// SetProductFeatured checks a SetProductFeaturedRequest. The ID is parsed by
+// the service like on the other single product RPCs.
+func SetProductFeatured(req *pb.SetProductFeaturedRequest) error {
+	var v Violations
+	if req.Featured && req.Rank < 0 {
+		v.Add("rank", "must not be negative")
+	}
+	return v.Err()
+}
+
+// StockLines checks the lines of a batch stock request.
+func StockLines(lines []*pb.StockLine) error {
+	var v Violations
+	if len(lines) == 0 {
+		v.Add("lines", "at least one line is required")
+	}
+	for i, line := range lines {
+		prefix := fmt.Sprintf("lines[%d].", i)
+		stockItem(&v, prefix, line.ProductId, line.VariantId)
+		if line.Quantity <= 0 {
+			v.Add(prefix+"quantity", "must be positive")
+		}
+	}
+	return v.Err()
+}
+
+// ReduceStock checks the product and variant of a ReduceStockRequest. The
+// quantity is checked with the stock, it has a reason of its own.
+func ReduceStock(req *pb.ReduceStockRequest) error {
+	var v Violations
+	stockItem(&v, "", req.ProductId, req.VariantId)
+	return v.Err()
+}
+
+// RestoreStock checks the product and variant of a RestoreStockRequest.
+func RestoreStock(req *pb.RestoreStockRequest) error {
+	var v Violations
+	stockItem(&v, "", req.ProductId, req.VariantId)
+	return v.Err()
+}
+
+func stockItem(v *Violations, prefix string, productID, variantID int64) {
+	if productID <= 0 {
+		v.Add(prefix+"productId", "must be positive")
+	}
+	if variantID < 0 {
+		v.Add(prefix+"variantId", "must not be negative")
+	}
+}
+
+func productFields(v *Violations, name, desc, image string) {
+	productName(v, name)
+	description(v, desc)
+	imageURL(v, image)
+}
+
+func productName(v *Violations, name string) {
+	switch {
+	case strings.TrimSpace(name) == "":
+		v.Add("productName", "is required")
+	case utf8.RuneCountInString(name) > maxNameLength:
+		v.Add("productName", "must be at most %d characters", maxNameLength)
+	}
+}
+
+func description(v *Violations, description string) {
+	if utf8.RuneCountInString(description) > maxDescriptionLength {
+		v.Add("description", "must be at most %d characters", maxDescriptionLength)
+	}
+}
+
+func imageURL(v *Violations, imageURL string) {
+	if imageURL == "" {
+		return
+	}
+	u, err := url.Parse(imageURL)
+	switch {
+	case len(imageURL) > maxImageURLLength:
+		v.Add("imageUrl", "must be at most %d characters", maxImageURLLength)
+	case err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "":
+		v.Add("imageUrl", "must be an absolute http or https URL")
+	}
+}
+
+// category checks categoryId, or the deprecated categoryName when
+// categoryId is unset.
+func category(v *Violations, id int64, name string) {
+	switch {
+	case id < 0:
+		v.Add("categoryId", "must be positive")
+	case id > 0:
+	case strings.TrimSpace(name) == "":
+		v.Add("categoryId", "is required")
+	case utf8.RuneCountInString(name) > maxCategoryLength:
+		v.Add("categoryName", "must be at most %d characters", maxCategoryLength)
+	}
+}
+
+// price checks listPrice, or the deprecated float price when listPrice is unset.
+func price(v *Violations, listPrice *pb.Money, legacy float32) {
+	if listPrice == nil {
+		switch {
+		case math.IsNaN(float64(legacy)) || math.IsInf(float64(legacy), 0):
+			v.Add("price", "must be a number")
+		case legacy < 0:
+			v.Add("price", "must not be negative")
+		case float64(legacy) >= money.MaxUnits:
+			v.Add("price", "must be less than %d", int64(money.MaxUnits))
+		}
+		return
+	}
+
+	minor, _, err := money.FromProto(listPrice, money.DefaultCurrency)
+	switch {
+	case err != nil:
+		v.Add("listPrice", "must have at most two decimal places and a three letter currency code")
+	case minor < 0:
+		v.Add("listPrice", "must not be negative")
+	}
+}
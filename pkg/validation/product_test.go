@@ -0,0 +1,126 @@
+package validation
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Manuelmastro/mobilehub-product/v3/pkg/pb"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+)
+
+func validAdd() *pb.AddProductRequest {
+	return &pb.AddProductRequest{
+		ProductName: "Pixel 9",
+		Description: "128 GB, Obsidian",
+		ImageUrl:    "https://cdn.example.com/pixel9.png",
+		ListPrice:   &pb.Money{CurrencyCode: "INR", Units: 79999, Nanos: 990_000_000},
+		Stock:       10,
+		CategoryId:  3,
+	}
+}
+
+func TestAddProduct(t *testing.T) {
+	tests := []struct {
+		name   string
+		mutate func(*pb.AddProductRequest)
+		fields []string
+	}{
+		{"valid", func(*pb.AddProductRequest) {}, nil},
+		{"empty name", func(r *pb.AddProductRequest) { r.ProductName = "  " }, []string{"productName"}},
+		{"negative stock", func(r *pb.AddProductRequest) { r.Stock = -1 }, []string{"stock"}},
+		{"negative price", func(r *pb.AddProductRequest) { r.ListPrice = &pb.Money{Units: -5} }, []string{"listPrice"}},
+		{"sub-paisa price", func(r *pb.AddProductRequest) { r.ListPrice.Nanos = 1 }, []string{"listPrice"}},
+		{"negative legacy price", func(r *pb.AddProductRequest) { r.ListPrice, r.Price = nil, -1 }, []string{"price"}},
+		{"huge legacy price", func(r *pb.AddProductRequest) { r.ListPrice, r.Price = nil, 1e30 }, []string{"price"}},
+		{"relative image", func(r *pb.AddProductRequest) { r.ImageUrl = "/img/p.png" }, []string{"imageUrl"}},
+		{"ftp image", func(r *pb.AddProductRequest) { r.ImageUrl = "ftp://example.com/p.png" }, []string{"imageUrl"}},
+		{"no image is fine", func(r *pb.AddProductRequest) { r.ImageUrl = "" }, nil},
+		{"no category", func(r *pb.AddProductRequest) { r.CategoryId = 0 }, []string{"categoryId"}},
+		{"legacy category name", func(r *pb.AddProductRequest) { r.CategoryId, r.CategoryName = 0, "Smartphones" }, nil},
+		{"negative category", func(r *pb.AddProductRequest) { r.CategoryId = -3 }, []string{"categoryId"}},
+		{"everything wrong", func(r *pb.AddProductRequest) {
+			*r = pb.AddProductRequest{Stock: -1, Price: -1, ImageUrl: "nope"}
+		}, []string{"productName", "imageUrl", "categoryId", "price", "stock"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := validAdd()
+			tt.mutate(req)
+			checkFields(t, AddProduct(req), tt.fields)
+		})
+	}
+}
+
+func TestEditProductID(t *testing.T) {
+	for _, id := range []string{"", "abc", "0", "-4", "1.5"} {
+		req := &pb.EditProductRequest{Id: id, ProductName: "x", CategoryId: 1, ExpectedVersion: 1}
+		checkFields(t, EditProduct(req), []string{"id"})
+	}
+}
+
+func TestStockLines(t *testing.T) {
+	checkFields(t, StockLines(nil), []string{"lines"})
+	checkFields(t, StockLines([]*pb.StockLine{
+		{ProductId: 1, Quantity: 1},
+		{ProductId: 0, Quantity: 0},
+	}), []string{"lines[1].productId", "lines[1].quantity"})
+}
+
+func TestSingleStockRequests(t *testing.T) {
+	checkFields(t, ReduceStock(&pb.ReduceStockRequest{ProductId: 3, Quantity: 1}), nil)
+	checkFields(t, ReduceStock(&pb.ReduceStockRequest{ProductId: -1, VariantId: -2, Quantity: 1}), []string{"productId", "variantId"})
+	checkFields(t, RestoreStock(&pb.RestoreStockRequest{ProductId: 0, Quantity: 1}), []string{"productId"})
+}
+
+func checkFields(t *testing.T, err error, want []string) {
+	t.Helper()
+	if want == nil {
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		return
+	}
+
+	var violations Violations
+	if !errors.As(err, &violations) {
+		t.Fatalf("got %v, want violations of %v", err, want)
+	}
+	if len(violations) != len(want) {
+		t.Fatalf("got %v, want violations of %v", violations, want)
+	}
+	for i, v := range violations {
+		if v.Field != want[i] {
+			t.Errorf("violation %d on %q, want %q", i, v.Field, want[i])
+		}
+	}
+}
+
+func TestEditMask(t *testing.T) {
+	req := &pb.EditProductRequest{Id: "1"}
+	if got := EditMask(req); len(got) != 5 {
+		t.Errorf("empty mask = %v, want every field but stock", got)
+	}
+
+	req.UpdateMask = &fieldmaskpb.FieldMask{Paths: []string{"price", "listPrice", "stock"}}
+	got := EditMask(req)
+	if len(got) != 2 || got[0] != PathListPrice || got[1] != PathStock {
+		t.Errorf("EditMask = %v, want [listPrice stock]", got)
+	}
+}
+
+func TestEditProductChecksMaskedFieldsOnly(t *testing.T) {
+	req := &pb.EditProductRequest{
+		Id:              "7",
+		ListPrice:       &pb.Money{Units: 499},
+		UpdateMask:      &fieldmaskpb.FieldMask{Paths: []string{"listPrice"}},
+		ExpectedVersion: 3,
+	}
+	checkFields(t, EditProduct(req), nil)
+
+	req.UpdateMask.Paths = append(req.UpdateMask.Paths, "color")
+	checkFields(t, EditProduct(req), []string{"updateMask.paths[1]"})
+
+	req.UpdateMask.Paths, req.ExpectedVersion = []string{"listPrice"}, 0
+	checkFields(t, EditProduct(req), []string{"expectedVersion"})
+}
@@ -0,0 +1,39 @@
+package validation
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Violation is one invalid field of a request. Field is the path of the
+// field in the JSON form of the request, lowerCamelCase whatever the proto
+// declares, e.g. "listPrice.nanos" or "lines[2].productId".
+type Violation struct {
+	Field       string
+	Description string
+}
+
+// Violations collects every problem with a request so the caller can fix
+// them all at once rather than one round trip at a time.
+type Violations []Violation
+
+func (v Violations) Error() string {
+	parts := make([]string, len(v))
+	for i, violation := range v {
+		parts[i] = violation.Field + ": " + violation.Description
+	}
+	return "invalid request: " + strings.Join(parts, "; ")
+}
+
+// Add records a violation of field.
+func (v *Violations) Add(field, format string, args ...any) {
+	*v = append(*v, Violation{Field: field, Description: fmt.Sprintf(format, args...)})
+}
+
+// Err returns v as an error, or nil when nothing was violated.
+func (v Violations) Err() error {
+	if len(v) == 0 {
+		return nil
+	}
+	return v
+}
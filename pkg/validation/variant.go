@@ -0,0 +1,161 @@
+package validation
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/Manuelmastro/mobilehub-product/v3/pkg/money"
+	"github.com/Manuelmastro/mobilehub-product/v3/pkg/pb"
+)
+
+const (
+	maxOptionNameLength  = 50
+	maxOptionValueLength = 100
+	maxVariantOptions    = 5
+)
+
+var skuPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,63}$`)
+
+// Update mask paths accepted by UpdateVariant.
+const (
+	VariantPathSKU      = "sku"
+	VariantPathOptions  = "options"
+	VariantPathPrice    = "price"
+	VariantPathStock    = "stock"
+	VariantPathImageURL = "image_url"
+)
+
+var (
+	variantPaths = []string{VariantPathSKU, VariantPathOptions, VariantPathPrice, VariantPathStock, VariantPathImageURL}
+
+	// defaultVariantPaths is what an empty update mask means, stock has to
+	// be asked for explicitly as with products.
+	defaultVariantPaths = []string{VariantPathSKU, VariantPathOptions, VariantPathPrice, VariantPathImageURL}
+)
+
+// AddVariant checks an AddVariantRequest before anything is written.
+func AddVariant(req *pb.AddVariantRequest) error {
+	var v Violations
+	if req.ProductId <= 0 {
+		v.Add("productId", "must be positive")
+	}
+	sku(&v, req.Sku)
+	variantOptions(&v, req.Options)
+	variantPrice(&v, req.Price)
+	if req.Stock < 0 {
+		v.Add("stock", "must not be negative")
+	}
+	imageURL(&v, req.ImageUrl)
+	return v.Err()
+}
+
+// VariantMask returns the fields an UpdateVariantRequest changes, without
+// duplicates. Unknown paths are dropped, UpdateVariant reports them.
+func VariantMask(req *pb.UpdateVariantRequest) []string {
+	if len(req.GetUpdateMask().GetPaths()) == 0 {
+		return defaultVariantPaths
+	}
+
+	var paths []string
+	seen := map[string]bool{}
+	for _, path := range req.UpdateMask.Paths {
+		if isVariantPath(path) && !seen[path] {
+			seen[path] = true
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// UpdateVariant checks an UpdateVariantRequest before anything is written.
+// Only the fields named by the update mask are checked.
+func UpdateVariant(req *pb.UpdateVariantRequest) error {
+	var v Violations
+	if req.Id <= 0 {
+		v.Add("id", "must be positive")
+	}
+	for i, path := range req.GetUpdateMask().GetPaths() {
+		if !isVariantPath(path) {
+			v.Add(fmt.Sprintf("updateMask.paths[%d]", i), "unknown field %q", path)
+		}
+	}
+
+	for _, path := range VariantMask(req) {
+		switch path {
+		case VariantPathSKU:
+			sku(&v, req.Sku)
+		case VariantPathOptions:
+			variantOptions(&v, req.Options)
+		case VariantPathPrice:
+			variantPrice(&v, req.Price)
+		case VariantPathStock:
+			if req.Stock < 0 {
+				v.Add("stock", "must not be negative")
+			}
+		case VariantPathImageURL:
+			imageURL(&v, req.ImageUrl)
+		}
+	}
+	return v.Err()
+}
+
+func isVariantPath(path string) bool {
+	for _, p := range variantPaths {
+		if p == path {
+			return true
+		}
+	}
+	return false
+}
+
+func sku(v *Violations, sku string) {
+	if !skuPattern.MatchString(sku) {
+		v.Add("sku", "must be 1 to 64 letters, digits, dots, dashes or underscores")
+	}
+}
+
+func variantOptions(v *Violations, options []*pb.VariantOption) {
+	switch {
+	case len(options) == 0:
+		v.Add("options", "at least one option is required")
+	case len(options) > maxVariantOptions:
+		v.Add("options", "must have at most %d options", maxVariantOptions)
+	}
+
+	seen := map[string]bool{}
+	for i, option := range options {
+		name := strings.ToLower(strings.TrimSpace(option.Name))
+		switch {
+		case name == "":
+			v.Add(fmt.Sprintf("options[%d].name", i), "is required")
+		case utf8.RuneCountInString(option.Name) > maxOptionNameLength:
+			v.Add(fmt.Sprintf("options[%d].name", i), "must be at most %d characters", maxOptionNameLength)
+		case seen[name]:
+			v.Add(fmt.Sprintf("options[%d].name", i), "duplicate option %q", option.Name)
+		}
+		seen[name] = true
+
+		switch {
+		case strings.TrimSpace(option.Value) == "":
+			v.Add(fmt.Sprintf("options[%d].value", i), "is required")
+		case utf8.RuneCountInString(option.Value) > maxOptionValueLength:
+			v.Add(fmt.Sprintf("options[%d].value", i), "must be at most %d characters", maxOptionValueLength)
+		}
+	}
+}
+
+func variantPrice(v *Violations, price *pb.Money) {
+	if price == nil {
+		v.Add("price", "is required")
+		return
+	}
+	minor, _, err := money.FromProto(price, money.DefaultCurrency)
+	switch {
+	case err != nil:
+		v.Add("price", "must have at most two decimal places and a three letter currency code")
+	case minor < 0:
+		v.Add("price", "must not be negative")
+	}
+}
@@ -0,0 +1,55 @@
+package validation
+
+import (
+	"testing"
+
+	"github.com/Manuelmastro/mobilehub-product/v3/pkg/pb"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+)
+
+func validAddVariant() *pb.AddVariantRequest {
+	return &pb.AddVariantRequest{
+		ProductId: 7,
+		Sku:       "PX9-OBS-128",
+		Options:   []*pb.VariantOption{{Name: "color", Value: "Obsidian"}, {Name: "storage", Value: "128 GB"}},
+		Price:     &pb.Money{CurrencyCode: "INR", Units: 79999},
+		Stock:     4,
+	}
+}
+
+func TestAddVariant(t *testing.T) {
+	tests := []struct {
+		name   string
+		mutate func(*pb.AddVariantRequest)
+		fields []string
+	}{
+		{"valid", func(*pb.AddVariantRequest) {}, nil},
+		{"no product", func(r *pb.AddVariantRequest) { r.ProductId = 0 }, []string{"productId"}},
+		{"sku with spaces", func(r *pb.AddVariantRequest) { r.Sku = "PX9 OBS" }, []string{"sku"}},
+		{"no options", func(r *pb.AddVariantRequest) { r.Options = nil }, []string{"options"}},
+		{"duplicate option", func(r *pb.AddVariantRequest) { r.Options[1].Name = " Color" }, []string{"options[1].name"}},
+		{"empty value", func(r *pb.AddVariantRequest) { r.Options[0].Value = "" }, []string{"options[0].value"}},
+		{"no price", func(r *pb.AddVariantRequest) { r.Price = nil }, []string{"price"}},
+		{"negative stock", func(r *pb.AddVariantRequest) { r.Stock = -1 }, []string{"stock"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := validAddVariant()
+			tt.mutate(req)
+			checkFields(t, AddVariant(req), tt.fields)
+		})
+	}
+}
+
+func TestUpdateVariantChecksOnlyMaskedFields(t *testing.T) {
+	req := &pb.UpdateVariantRequest{Id: 3, Stock: 2, UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"stock"}}}
+	checkFields(t, UpdateVariant(req), nil)
+
+	req.UpdateMask.Paths = []string{"stock", "colour"}
+	checkFields(t, UpdateVariant(req), []string{"updateMask.paths[1]"})
+
+	// Without a mask everything but stock is replaced and must be valid.
+	req.UpdateMask = nil
+	checkFields(t, UpdateVariant(req), []string{"sku", "options", "price"})
+}
@@ -0,0 +1,57 @@
+package worker
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// Every runs fn once per interval until ctx is cancelled. Errors are logged
+// and the next run still happens, a failing sweep should not stop the service.
+// A worker without a positive interval never runs.
+func Every(ctx context.Context, name string, interval time.Duration, fn func(context.Context) error) {
+	if interval <= 0 {
+		log.Printf("%s: interval %s is not positive, not running", name, interval)
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := fn(ctx); err != nil {
+				log.Printf("%s: %v", name, err)
+			}
+		}
+	}
+}
+
+// Group runs workers until its context is cancelled, so shutdown can wait
+// for the runs in progress instead of cutting them off.
+type Group struct {
+	ctx context.Context
+	wg  sync.WaitGroup
+}
+
+func NewGroup(ctx context.Context) *Group {
+	return &Group{ctx: ctx}
+}
+
+// Every starts a worker running fn once per interval, see Every.
+func (g *Group) Every(name string, interval time.Duration, fn func(context.Context) error) {
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		Every(g.ctx, name, interval, fn)
+	}()
+}
+
+// Wait returns once every worker has stopped, after the context is cancelled.
+func (g *Group) Wait() {
+	g.wg.Wait()
+}